@@ -1,12 +1,148 @@
 // Package main is the entry point of the Ebash shell application.
-// It simply calls ebash.Run() to start the interactive shell.
+// It parses the command line and hands the resulting options to ebash.Run.
 package main
 
-import "Ebash/internal/ebash"
+import (
+	"fmt"
+	"os"
+	"strings"
 
-// main starts the Ebash interactive shell.
+	"Ebash/internal/ebash"
+)
+
+// version is the ebash release reported by --version. It is meant to be
+// overridden at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const usage = `Usage: ebash [option ...] [file [argument ...]]
+       ebash [option ...] -c string [name [argument ...]]
+
+Options:
+  -c                  read commands from the first non-option argument
+  -i, --interactive   force an interactive shell
+  -l, --login         act as a login shell
+  -e                  exit immediately when a command fails
+  -x                  print commands and their arguments as they are executed
+      --config PATH   load terminal and prompt settings from PATH
+      --norc          do not read the startup files of interactive shells
+      --noprofile     do not read the login profile
+      --dump-ast      print the parsed pipelines instead of executing them
+      --version       print version information and exit
+      --help          print this help and exit
+`
+
+// main parses the command line, starts the shell and exits with its status.
 func main() {
 
-	ebash.Run()
+	opts, exit, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ebash: %v\n%s", err, usage)
+		os.Exit(2)
+	} else if exit {
+		os.Exit(0)
+	}
+
+	os.Exit(ebash.Run(opts))
+
+}
+
+// parseArgs converts the command-line arguments into ebash.Options the way
+// bash does: short options may be clustered ("-ex"), long options take
+// their value either inline ("--config=PATH") or from the next argument,
+// and option parsing stops at "--", "-" or the first operand. With -c the
+// first operand is the command string, otherwise it is the script to run;
+// the remaining operands become the positional parameters. The returned
+// bool reports that there is nothing left to do (--help, --version or an
+// empty command string) and the program should exit successfully.
+func parseArgs(args []string) (ebash.Options, bool, error) {
+
+	var opts ebash.Options
+	var command bool
+
+	i := 0
+
+	for ; i < len(args); i++ {
+
+		arg := args[i]
+
+		if arg == "--" || arg == "-" {
+			i++
+			break
+		} else if !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--") {
+
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+
+			switch name {
+			case "config":
+				if !hasValue {
+					if i+1 >= len(args) {
+						return opts, false, fmt.Errorf("--config: option requires an argument")
+					}
+					i++
+					value = args[i]
+				}
+				opts.ConfigPath = value
+			case "norc":
+				opts.NoRC = true
+			case "noprofile":
+				opts.NoProfile = true
+			case "interactive":
+				opts.Interactive = true
+			case "login":
+				opts.Login = true
+			case "dump-ast":
+				opts.DumpAST = true
+			case "version":
+				fmt.Printf("ebash, version %s\n", version)
+				return opts, true, nil
+			case "help":
+				fmt.Print(usage)
+				return opts, true, nil
+			default:
+				return opts, false, fmt.Errorf("%s: invalid option", arg)
+			}
+
+			continue
+
+		}
+
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'c':
+				command = true
+			case 'i':
+				opts.Interactive = true
+			case 'l':
+				opts.Login = true
+			case 'e':
+				opts.ErrExit = true
+			case 'x':
+				opts.XTrace = true
+			default:
+				return opts, false, fmt.Errorf("-%c: invalid option", flag)
+			}
+		}
+
+	}
+
+	operands := args[i:]
+
+	if command {
+		if len(operands) == 0 {
+			return opts, false, fmt.Errorf("-c: option requires an argument")
+		}
+		if operands[0] == "" {
+			return opts, true, nil
+		}
+		opts.Command, opts.Args = operands[0], operands[1:]
+	} else if len(operands) > 0 {
+		opts.Script, opts.Args = operands[0], operands
+	}
+
+	return opts, false, nil
 
 }
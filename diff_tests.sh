@@ -27,11 +27,15 @@ commands=(
     "ls | sort | grep Makefile"
     "false && echo NOT OK || echo OK | cat"
     "echo qwe > tmp2.txt && cat tmp2.txt"
+    $'cd / | cat\npwd'
+    $'export EBASH_PIPED=1 | cat\necho "[$EBASH_PIPED]"'
+    $'echo piped | cd / && pwd'
 )
 
 log=$(mktemp)
 
 for cmd in "${commands[@]}"; do
+    name=${cmd//$'\n'/; }
     tmp1=$(mktemp)
     tmp2=$(mktemp)
 
@@ -39,9 +43,66 @@ for cmd in "${commands[@]}"; do
     bash -c "$cmd" 2>&1 > "$tmp2"
 
     if diff -u "$tmp1" "$tmp2" > /dev/null; then
-        echo "Test passed: $cmd" | tee -a "$log"
+        echo "Test passed: $name" | tee -a "$log"
     else
-        echo "Test failed: $cmd" | tee -a "$log"
+        echo "Test failed: $name" | tee -a "$log"
+        diff -u "$tmp1" "$tmp2" | tee -a "$log"
+    fi
+
+    rm -f "$tmp1" "$tmp2"
+done
+
+# Command strings run with -c and the positional parameters "name one two";
+# their output and exit status are compared.
+scripts=(
+    $'false\necho $?'
+    "nonexistent_ebash_command"
+    "/etc/passwd"
+    $'sh -c \'kill -TERM $$\'\necho $?'
+    "| cat"
+    "echo a | | cat"
+    "cat < nonexistent_ebash_file"
+    'echo $0 $1 $2 $#'
+    "exit 3"
+    $'false\nexit'
+    $'exit 3 | cat\necho after'
+    $'echo before | exit 4\necho $?'
+    $'echo a > tmp_leak.txt\necho b\necho c\necho d\necho e\ncat tmp_leak.txt'
+    $'echo \'echo Sourced\' > tmp_source.sh\nsource ./tmp_source.sh | tr a-z A-Z'
+    $'echo \'echo Sourced\' > tmp_source.sh\n. ./tmp_source.sh > tmp_source.txt\ncat tmp_source.txt'
+    $'echo \'cat\' > tmp_source.sh\necho piped | source ./tmp_source.sh'
+    $'set -C\necho a > tmp_clobber.txt\necho b > tmp_clobber.txt\necho $?\necho c >| tmp_clobber.txt\ncat tmp_clobber.txt'
+    $'set -e\nfalse\necho not reached'
+    $'set -e\nfalse || echo handled\necho reached'
+    $'set -eo pipefail\nfalse | true\necho not reached'
+    $'set -o pipefail\nfalse | true\necho $?'
+    $'set -eo nounset\necho $NONEXISTENT_EBASH_VAR\necho not reached'
+    $'set -o bogus\necho $?'
+    $'set -- a b c\necho $# $2'
+    $'echo Make*\nset -f\necho Make*'
+    $'shopt -s nullglob\necho nonexistent*.ebash end'
+    $'shopt -s failglob\necho nonexistent*.ebash\necho $?'
+    $'shopt -q nullglob\necho $?\nshopt -s nullglob\nshopt -q nullglob\necho $?'
+    $'set -e\ncat < nonexistent_ebash_file\necho not reached'
+    $'shopt -s failglob\nset -e\necho nonexistent*.ebash\necho not reached'
+    $'trap \'echo err\' ERR\ncat < nonexistent_ebash_file\necho $?'
+    $'trap \'echo bye\' INT TERM EXIT\ntrap\ntrap -p INT'
+)
+
+for cmd in "${scripts[@]}"; do
+    name=${cmd//$'\n'/; }
+    tmp1=$(mktemp)
+    tmp2=$(mktemp)
+
+    ./ebash -c "$cmd" name one two < /dev/null > "$tmp1" 2> /dev/null
+    echo "status $?" >> "$tmp1"
+    bash -c "$cmd" name one two < /dev/null > "$tmp2" 2> /dev/null
+    echo "status $?" >> "$tmp2"
+
+    if diff -u "$tmp1" "$tmp2" > /dev/null; then
+        echo "Test passed: -c $name" | tee -a "$log"
+    else
+        echo "Test failed: -c $name" | tee -a "$log"
         diff -u "$tmp1" "$tmp2" | tee -a "$log"
     fi
 
@@ -59,7 +120,45 @@ else
     diff -u "test" "test2" | tee -a "$log"
 fi
 
-rm -f "tmp1.txt" "tmp2.txt" ">" "test" "test2"
+# Scripts read from stdin, through a pipe and from a file; the commands of
+# the script read the rest of it.
+stdin_scripts=(
+    $'cat\nhello'
+    $'echo a\nhead -c 2 > /dev/null\nXXecho b'
+    "echo $(printf 'x%.0s' {1..70000}) | wc -c"
+)
+
+for cmd in "${stdin_scripts[@]}"; do
+    name=${cmd//$'\n'/; }
+    name=${name:0:60}
+    printf '%s\n' "$cmd" > tmp_stdin.sh
+
+    if diff -u <(printf '%s\n' "$cmd" | ./ebash 2>&1) <(printf '%s\n' "$cmd" | bash 2>&1) > /dev/null &&
+        diff -u <(./ebash < tmp_stdin.sh 2>&1) <(bash < tmp_stdin.sh 2>&1) > /dev/null; then
+        echo "Test passed: stdin $name" | tee -a "$log"
+    else
+        echo "Test failed: stdin $name" | tee -a "$log"
+    fi
+done
+
+# Commands traced by set -x, compared on stderr.
+trace='set -x
+echo "a b" '"''"' "it'"'"'s" plain \$HOME "*"'
+
+if diff -u <(./ebash -c "$trace" 2>&1) <(bash -c "$trace" 2>&1) > /dev/null; then
+    echo "Test passed: set -x quoting" | tee -a "$log"
+else
+    echo "Test failed: set -x quoting" | tee -a "$log"
+    diff -u <(./ebash -c "$trace" 2>&1) <(bash -c "$trace" 2>&1) | tee -a "$log"
+fi
+
+if ./ebash --config nonexistent_ebash_config.yaml -c true 2>&1 | grep -q "failed to load config"; then
+    echo "Test passed: --config with -c" | tee -a "$log"
+else
+    echo "Test failed: --config with -c" | tee -a "$log"
+fi
+
+rm -f "tmp1.txt" "tmp2.txt" ">" "test" "test2" "tmp_source.sh" "tmp_source.txt" "tmp_leak.txt" "tmp_clobber.txt" "tmp_stdin.sh"
 rm -rf temp_test_dir
 
 if grep -q "Test failed" "$log"; then
@@ -1,5 +1,5 @@
 // Package builtin implements a set of simple shell builtin commands used by ebash.
-// It provides functions to execute builtins such as cd, pwd, echo, kill, and ps.
+// It provides functions to execute builtins such as cd, pwd, echo, kill, ps and export.
 // The implementations are intentionally minimal and intended for educational
 // purposes within the ebash project.
 package builtin
@@ -11,49 +11,65 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"unicode"
 
 	ps "github.com/mitchellh/go-ps"
 )
 
 // Execute runs a builtin command based on the provided command slice.
 // The function inspects command[0] and dispatches to the matching builtin
-// implementation (cd, pwd, echo, kill, ps). If lastInPipeline is true,
-// the output is directed to outputFile when it is non-nil, otherwise to stdout.
-// Execute returns an error when a builtin reports failure, or nil on success.
-func Execute(command []string, writer, outputFile *os.File, lastInPipeline bool) error {
-
-	if lastInPipeline {
-		if outputFile != nil {
-			writer = outputFile
-		} else {
-			writer = os.Stdout
-		}
-	}
+// implementation (cd, pwd, echo, kill, ps, export). Builtins read from stdin and
+// write to stdout and stderr exactly like external commands do, so they can
+// be placed anywhere in a pipeline. Execute returns an error when a builtin
+// reports failure, or nil on success.
+func Execute(command []string, stdin io.Reader, stdout, stderr io.Writer) error {
 
 	switch command[0] {
 	case "cd", "cd..":
-		return changeDirectory(command)
+		return changeDirectory(command, os.Chdir)
 	case "pwd":
-		return printWorkingDirectory(writer)
+		return printWorkingDirectory(stdout)
 	case "echo":
-		return echo(command, writer)
+		return echo(command, stdout)
 	case "kill":
 		return kill(command)
 	case "ps":
-		return processStatus(writer)
+		return processStatus(stdout)
+	case "export":
+		return export(command, stdout, os.Setenv)
 	}
 
 	return nil
 
 }
 
+// Subshell runs a builtin the way it runs in a subshell, such as a stage of
+// a pipeline, whose changes to the working directory and the environment do
+// not outlive it: cd and export check their arguments and report errors
+// like Execute does, but change nothing. Every other builtin is passed on
+// to Execute.
+func Subshell(command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	switch command[0] {
+	case "cd", "cd..":
+		return changeDirectory(command, checkDirectory)
+	case "export":
+		return export(command, stdout, func(string, string) error { return nil })
+	}
+
+	return Execute(command, stdin, stdout, stderr)
+
+}
+
 // changeDirectory changes the current working directory according to the
-// arguments in the command slice. Returns an error for too many arguments
-// or when the target path does not exist or is not a directory.
-func changeDirectory(command []string) error {
+// arguments in the command slice, through chdir. Returns an error for too
+// many arguments or when the target path does not exist or is not a
+// directory.
+func changeDirectory(command []string, chdir func(string) error) error {
 
 	var dir string
 
@@ -68,7 +84,7 @@ func changeDirectory(command []string) error {
 		dir = command[1]
 	}
 
-	if err := os.Chdir(dir); err != nil {
+	if err := chdir(dir); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("ebash: cd: %s: Not a directory", dir)
 		}
@@ -79,6 +95,25 @@ func changeDirectory(command []string) error {
 
 }
 
+// checkDirectory fails the way os.Chdir fails for dir, without changing the
+// working directory.
+func checkDirectory(dir string) error {
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return &os.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	} else if err := syscall.Access(dir, 1); err != nil { // X_OK: the directory can be searched
+		return &os.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+
+	return nil
+
+}
+
 // printWorkingDirectory writes the current working directory path to the
 // provided writer. Returns an error if the current directory cannot be
 // determined.
@@ -177,3 +212,52 @@ func psPrep(writer io.Writer) (string, *regexp.Regexp, []ps.Process, error) {
 	return path, re, processes, nil
 
 }
+
+// export sets environment variables from NAME=value arguments, through
+// setenv, so that they are inherited by every command started afterwards.
+// A bare NAME is accepted and left untouched, since every ebash variable is
+// already exported. Without arguments the environment is listed in the
+// "declare -x" format of bash.
+func export(command []string, writer io.Writer, setenv func(string, string) error) error {
+
+	if len(command) == 1 {
+		environ := os.Environ()
+		sort.Strings(environ)
+		for _, variable := range environ {
+			name, value, _ := strings.Cut(variable, "=")
+			if _, err := fmt.Fprintf(writer, "declare -x %s=%q\n", name, value); err != nil {
+				return fmt.Errorf("ebash: export: write operation failed: %w", err)
+			}
+		}
+		return nil
+	}
+
+	for _, arg := range command[1:] {
+		name, value, assignment := strings.Cut(arg, "=")
+		if !validName(name) {
+			return fmt.Errorf("ebash: export: `%s': not a valid identifier", arg)
+		}
+		if assignment {
+			if err := setenv(name, value); err != nil {
+				return fmt.Errorf("ebash: export: %w", err)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// validName reports whether name is a valid shell variable name: a letter
+// or underscore followed by letters, digits and underscores.
+func validName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, char := range name {
+		if char != '_' && !unicode.IsLetter(char) && !unicode.IsDigit(char) {
+			return false
+		}
+	}
+	return true
+}
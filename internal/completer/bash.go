@@ -0,0 +1,134 @@
+package completer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// bashCompletionDirs lists the directories bash-completion loads the
+// completion file of a command from, in order of preference.
+var bashCompletionDirs = []string{
+	"~/.local/share/bash-completion/completions",
+	"/usr/local/share/bash-completion/completions",
+	"/usr/share/bash-completion/completions",
+	"/etc/bash_completion.d",
+}
+
+// bashCompletionScripts lists the places the main bash-completion script,
+// which defines the helpers completion files rely on, is installed at.
+var bashCompletionScripts = []string{
+	"/usr/share/bash-completion/bash_completion",
+	"/usr/local/share/bash-completion/bash_completion",
+	"/etc/bash_completion",
+}
+
+// bashRunner is the bash script that runs a completion function. It is
+// given the command name, the completion file, the main bash-completion
+// script (or ""), the index of the word being completed, the line up to
+// the cursor and the words of the command. It prints COMPREPLY, one
+// completion per line.
+const bashRunner = `cmd=$1 file=$2 main=$3 COMP_CWORD=$4 COMP_LINE=$5
+shift 5
+COMP_WORDS=("$@") COMP_POINT=${#COMP_LINE} COMP_TYPE=9 COMP_KEY=9
+[[ -n $main ]] && source "$main" >/dev/null 2>&1
+source "$file" >/dev/null 2>&1
+spec=$(complete -p -- "$cmd" 2>/dev/null) || exit 1
+cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+COMPREPLY=()
+if [[ $spec =~ \ -F\ ([^ ]+) ]]; then
+	"${BASH_REMATCH[1]}" "$cmd" "$cur" "$prev" >/dev/null 2>&1
+else
+	spec=${spec#complete } spec=${spec% *}
+	eval "COMPREPLY=(\$(compgen $spec -- \"\$cur\"))" 2>/dev/null
+fi
+printf '%s\n' "${COMPREPLY[@]}"
+`
+
+// bashDefinition completes the arguments of a command by running the
+// function its bash-completion file registers, in bash.
+type bashDefinition struct {
+	bash   string // path of the bash executable
+	file   string // completion file of the command
+	script string // main bash-completion script, or "" if it is not installed
+}
+
+// findBashDefinition returns the bash-completion definition of the command
+// name, or nil if it has none or bash is not installed.
+func findBashDefinition(name string) definition {
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return nil
+	}
+
+	file := findFile(bashCompletionDirs, name, "_"+name, name+".bash")
+	if file == "" {
+		return nil
+	}
+
+	return &bashDefinition{bash: bash, file: file, script: findFile(bashCompletionScripts)}
+
+}
+
+// complete runs the completion function of the command for req, the way
+// bash does when Tab is pressed, until the deadline of req. Words that name
+// directories continue as paths. Files are offered instead when the
+// function offers nothing.
+func (def *bashDefinition) complete(req request) ([]candidate, bool) {
+
+	ctx, cancel := context.WithDeadline(context.Background(), req.deadline)
+	defer cancel()
+
+	args := []string{"-c", bashRunner, "bash", req.command, def.file, def.script, strconv.Itoa(len(req.words) - 1), req.line}
+	cmd := providerCommand(ctx, def.bash, append(args, req.words...)...)
+
+	output, _ := cmd.Output()
+
+	var candidates []candidate
+
+	for _, text := range strings.Split(string(output), "\n") {
+		text = strings.TrimRight(text, " ")
+		if text == "" {
+			continue
+		}
+		info, err := os.Stat(expandHome(text))
+		dir := strings.HasSuffix(text, "/") || (err == nil && info.IsDir())
+		candidates = append(candidates, candidate{text: strings.TrimSuffix(text, "/"), dir: dir})
+	}
+
+	return candidates, len(candidates) == 0
+
+}
+
+// findFile returns the first of the files named by names that exists in
+// dirs, or the first existing path in dirs when no names are given. A
+// leading "~" in dirs stands for the home directory.
+func findFile(dirs []string, names ...string) string {
+
+	for _, dir := range dirs {
+
+		dir = expandHome(dir)
+
+		if len(names) == 0 {
+			if _, err := os.Stat(dir); err == nil {
+				return dir
+			}
+			continue
+		}
+
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path
+			}
+		}
+
+	}
+
+	return ""
+
+}
@@ -0,0 +1,73 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirCacheSize is the number of directory listings kept by listings.
+const dirCacheSize = 64
+
+// listings caches the directories listed for completion.
+var listings = dirCache{entries: make(map[string]dirListing)}
+
+// dirCache remembers the entries of the directories listed for completion,
+// so that completing again in a large directory does not read it again. A
+// listing is valid as long as the modification time of its directory is
+// unchanged, which any creation, removal or renaming in the directory
+// updates. A listing made within a second of that time is not trusted, as
+// the directory may have changed again within the resolution of the clock
+// of its file system.
+type dirCache struct {
+	mu      sync.Mutex            // guards entries, as compgen completes from the shell goroutine
+	entries map[string]dirListing // listings, by directory
+}
+
+// dirListing is the listing of a directory.
+type dirListing struct {
+	modTime time.Time     // modification time of the directory when it was listed
+	listed  time.Time     // time it was listed at
+	entries []os.DirEntry // its entries, sorted by name
+}
+
+// readDir returns the entries of dir, sorted by name, from the cache if
+// the directory has not changed since it was listed.
+func readDir(dir string) ([]os.DirEntry, error) {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listings.mu.Lock()
+	cached, ok := listings.entries[dir]
+	listings.mu.Unlock()
+
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.listed.Sub(cached.modTime) > time.Second {
+		return cached.entries, nil
+	}
+
+	listed := time.Now()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listings.mu.Lock()
+	if len(listings.entries) >= dirCacheSize {
+		clear(listings.entries)
+	}
+	listings.entries[dir] = dirListing{modTime: info.ModTime(), listed: listed, entries: entries}
+	listings.mu.Unlock()
+
+	return entries, nil
+
+}
@@ -0,0 +1,105 @@
+package completer
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// commandIndex lists the executable files found in the directories of
+// $PATH. It is built the first time it is needed and rebuilt only when
+// $PATH changes or one of its directories is modified.
+type commandIndex struct {
+	path     string      // value of $PATH the index was built for
+	built    bool        // whether the index was built at all
+	modTimes []time.Time // modification times of the directories of $PATH when it was built
+	names    []string    // names of the executables, sorted and without duplicates
+}
+
+// refresh rebuilds the index if $PATH or one of its directories changed
+// since it was built.
+func (index *commandIndex) refresh() {
+
+	path := os.Getenv("PATH")
+	dirs := filepath.SplitList(path)
+
+	modTimes := make([]time.Time, len(dirs))
+	for i, dir := range dirs {
+		if info, err := os.Stat(cmp.Or(dir, ".")); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+
+	if index.built && path == index.path && slices.EqualFunc(modTimes, index.modTimes, time.Time.Equal) {
+		return
+	}
+
+	index.path, index.built, index.modTimes = path, true, modTimes
+	index.names = nil
+
+	for _, dir := range dirs {
+
+		if dir == "" {
+			dir = "."
+		}
+
+		entries, err := readDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if isExecutable(filepath.Join(dir, entry.Name()), entry) {
+				index.names = append(index.names, entry.Name())
+			}
+		}
+
+	}
+
+	slices.Sort(index.names)
+	index.names = slices.Compact(index.names)
+
+}
+
+// clone returns a copy of the index that can be refreshed without changing
+// the index.
+func (index *commandIndex) clone() commandIndex {
+	return commandIndex{
+		path:     index.path,
+		built:    index.built,
+		modTimes: slices.Clone(index.modTimes),
+		names:    slices.Clone(index.names),
+	}
+}
+
+// isExecutable reports whether entry, found at path, is a file (or a
+// symbolic link to a file) that can be executed by someone.
+func isExecutable(path string, entry os.DirEntry) bool {
+
+	var info os.FileInfo
+	var err error
+
+	if entry.Type()&os.ModeSymlink != 0 {
+		info, err = os.Stat(path)
+	} else {
+		info, err = entry.Info()
+	}
+
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+
+}
+
+// commandNames returns the command names starting with prefix among the
+// executables of $PATH and the builtins and aliases of the shell.
+func (c *Completer) commandNames(prefix string) []candidate {
+
+	c.commands.refresh()
+
+	names := slices.Concat(c.commands.names, c.builtins(), c.aliases())
+	slices.Sort(names)
+
+	return matching(slices.Compact(names), prefix)
+
+}
@@ -0,0 +1,35 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCloneCommandIndex(t *testing.T) {
+
+	first, second := t.TempDir(), t.TempDir()
+	for _, path := range []string{filepath.Join(first, "aaa"), filepath.Join(second, "bbb")} {
+		if err := os.WriteFile(path, nil, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", first)
+
+	parent := NewCompleter(nil, nil)
+	parent.commands.refresh()
+
+	clone := parent.Clone()
+	t.Setenv("PATH", second)
+	clone.commands.refresh()
+
+	if !slices.Equal(parent.commands.names, []string{"aaa"}) {
+		t.Errorf("parent index = %q after refreshing the clone, want [aaa]", parent.commands.names)
+	}
+	if !slices.Equal(clone.commands.names, []string{"bbb"}) {
+		t.Errorf("clone index = %q, want [bbb]", clone.commands.names)
+	}
+
+}
@@ -1,98 +1,338 @@
-// Package completer provides filesystem- and process-aware tab completion
-// for the ebash shell. It dynamically builds completion suggestions for
-// common shell commands based on the current directory contents and running
-// system processes.
+// Package completer provides programmable tab completion for the ebash
+// shell. It completes command names from the executables of $PATH and the
+// builtins and aliases of the shell, and the arguments of a command as its
+// completion specification says (see Spec), or else as its fish or
+// bash-completion completion file says, and as paths at any depth when it
+// has none of those. The options of such commands are read from their manual
+// page, or from their --help output when RunHelp is set.
 package completer
 
 import (
-	"os"
-	"strconv"
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/chzyer/readline"
+	"Ebash/internal/parser"
 )
 
-// Completer adapts ebash's dynamic environment (filesystem and processes)
-// to the readline.AutoCompleter interface. It generates and updates
-// command-specific completion suggestions on each loop iteration.
+// Completer adapts ebash's dynamic environment (filesystem, processes and
+// the definitions of the shell) to the completion menu of the line editor.
+// Completions are computed when they are asked for, from the registry of
+// completion specifications filled by the complete builtin.
 type Completer struct {
-	readlineCompleter *readline.PrefixCompleter
+	commands commandIndex    // executables of $PATH
+	aliases  func() []string // returns the names of the aliases of the shell
+	builtins func() []string // returns the names of the builtins of the shell
+	specs    map[string]Spec // completion specifications, by command name
+
+	definitions map[string]definition  // completion files of other shells, by command name; nil for none
+	options     map[string]helpOptions // options read from --help output and manual pages, by executable path
+
+	RunHelp bool // run "name --help" to find the options of commands in $PATH (shopt complete_help)
+}
+
+// candidate is a possible completion of a word.
+type candidate struct {
+	text        string // the completed word, without quotes
+	description string // what the word stands for, if known
+	dir         bool   // the word names a directory, so the completion goes on after a slash
+	file        bool   // the word is the path of a file
 }
 
-// NewCompleter returns a new Completer instance with an empty
-// underlying PrefixCompleter.
-func NewCompleter() *Completer {
-	return &Completer{readlineCompleter: readline.NewPrefixCompleter()}
+// request describes the word being completed and its surroundings, as
+// passed to the commands of a specification.
+type request struct {
+	command  string   // name of the command the word is an argument of
+	word     string   // word being completed, without quotes
+	previous string   // word before it
+	words    []string // words of the command up to the one being completed, which is the last
+	line     string   // line up to the cursor
+
+	deadline time.Time // time by which slow providers must have answered
 }
 
-// Update rebuilds the completion tree based on the current working directory
-// and system state. It scans files, directories, and running processes to
-// provide up-to-date suggestions for commands like "cd", "ls", "kill",
-// "rm", "cat", and others.
-func (c *Completer) Update() {
+// budget bounds the time a completion may spend in slow providers: the
+// commands of specifications and the completion functions of bash and git
+// they run. Those still running when it runs out are killed and offer
+// nothing, so that Tab never hangs the line.
+const budget = 2 * time.Second
+
+// providerCommand returns the command of a slow provider, bound to ctx. It
+// runs in a process group of its own, all of which is killed when ctx is
+// done, and its output is abandoned shortly after, so that children left
+// holding the pipes cannot outlive the budget either.
+func providerCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
 
-	entries, err := os.ReadDir(".")
-	if err != nil {
-		return
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 	}
+	cmd.WaitDelay = 100 * time.Millisecond
 
-	var onlyDirs []readline.PrefixCompleterInterface
-	var procsToKill []readline.PrefixCompleterInterface
-	var rmCompleter []readline.PrefixCompleterInterface
-	var fileNamesToComplete []readline.PrefixCompleterInterface
+	return cmd
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			fileNamesToComplete = append(fileNamesToComplete, readline.PcItem(entry.Name()+"/"))
-			onlyDirs = append(onlyDirs, readline.PcItem(entry.Name()+"/"))
-		} else {
-			fileNamesToComplete = append(fileNamesToComplete, readline.PcItem(entry.Name()))
-		}
+// NewCompleter returns a new Completer. aliases and builtins return the
+// names of the aliases and builtins of the shell. The arguments of "cd" are
+// completed with directories and those of "kill" with processes, until the
+// complete builtin says otherwise.
+func NewCompleter(aliases, builtins func() []string) *Completer {
+	return &Completer{
+		aliases:  aliases,
+		builtins: builtins,
+		specs: map[string]Spec{
+			"cd":   {Actions: []string{"directory"}},
+			"kill": {Actions: []string{"process"}},
+		},
+		definitions: make(map[string]definition),
+		options:     make(map[string]helpOptions),
+	}
+}
+
+// Item is a completion of the word before the cursor, as returned by
+// Complete.
+type Item struct {
+	Text        string // text replacing the word as it was typed: quoted like it, followed by a slash or a space
+	Display     string // name shown in menus: the completion after the last slash of the word
+	Description string // what the completion stands for, if known
+	Path        string // file the completion names, if it is a path
+}
+
+// Complete completes the word before the cursor of line. It returns the
+// position of the word in line, in runes, and the items that can replace
+// it. A command name being typed is completed from the executables of
+// $PATH and the names the shell defines; an empty one is not, as it would
+// list every command. A command name containing a slash is completed as the
+// path of an executable, and an argument as the specification of its
+// command says, or else as its completion file for fish or bash does, as a
+// path if there is none. A variable reference ending the word is completed
+// with the names of the environment variables, "~name" with the names of
+// the users, and an argument completed with process IDs with the processes
+// whose ID or name it starts. An option is completed from the manual page,
+// or the --help output when RunHelp is set, of a command that has none of
+// those. When nothing starts with the word, the completions of its
+// directory containing what follows its last slash, or its runes in order,
+// are offered instead.
+func (c *Completer) Complete(line []rune, pos int) (int, []Item) {
+
+	text := string(line[:pos])
+
+	word, ok := parser.LastWord(text)
+	if !ok {
+		return 0, nil
 	}
 
-	toKill := getPIDs()
-	for _, val := range toKill {
-		procsToKill = append(procsToKill, readline.PcItem(val))
+	start := len([]rune(text[:word.Start]))
+
+	raw := text[word.Start:]
+	if name, length, braced, ok := variablePrefix(raw); ok {
+		return start, variables(raw, name, length, braced)
+	}
+
+	if word.Text == "" && raw != "" {
+		return 0, nil
+	}
+
+	if word.Kind == parser.Argument {
+		req := newRequest(text, word)
+		if spec, ok := c.specs[req.command]; ok && processSpec(spec) && !strings.HasPrefix(req.word, "-") {
+			var items []Item
+			for _, p := range processes(req.word) {
+				items = append(items, Item{Text: p.pid + " ", Display: p.pid, Description: p.description()})
+			}
+			return start, items
+		}
 	}
 
-	rmCompleter = append(rmCompleter, fileNamesToComplete...)
-	rmCompleter = append(rmCompleter, readline.PcItem("-rf", fileNamesToComplete...))
+	items := suffixes(raw, word.Text, c.candidates(text, word, word.Text))
 
-	newCompleter := readline.NewPrefixCompleter(
-		readline.PcItem("cd", onlyDirs...),
-		readline.PcItem("rm", rmCompleter...),
-		readline.PcItem("kill", procsToKill...),
-		readline.PcItem("ps", fileNamesToComplete...),
-		readline.PcItem("ls", fileNamesToComplete...),
-		readline.PcItem("cat", fileNamesToComplete...),
-		readline.PcItem("cut", fileNamesToComplete...),
-		readline.PcItem("vim", fileNamesToComplete...),
-		readline.PcItem("grep", fileNamesToComplete...),
-		readline.PcItem("echo", fileNamesToComplete...),
-	)
+	dir := word.Text[:strings.LastIndexByte(word.Text, '/')+1]
+	if len(items) == 0 && word.Text != dir {
+		items = approximate(word.Text[len(dir):], dir, c.candidates(text, word, dir))
+	}
 
-	c.readlineCompleter = newCompleter
+	return start, items
 
 }
 
-// Do delegates the completion logic to the underlying PrefixCompleter.
-// It satisfies the readline.AutoCompleter interface.
-func (c *Completer) Do(line []rune, pos int) ([][]rune, int) {
-	return c.readlineCompleter.Do(line, pos)
+// candidates returns the candidates completing prefix, which stands for
+// word, the last word of line.
+func (c *Completer) candidates(line string, word parser.Span, prefix string) []candidate {
+
+	raw := line[word.Start:]
+
+	switch {
+	case word.Kind == parser.Command && strings.ContainsRune(raw, '/'):
+		return paths(prefix, pathFilter{commands: true})
+	case word.Kind == parser.Command:
+		if prefix == "" {
+			return nil
+		}
+		return c.commandNames(prefix)
+	case strings.HasPrefix(prefix, "~") && prefix != "~" && !strings.Contains(prefix, "/"):
+		return userNames(prefix[1:])
+	}
+
+	req := newRequest(line, word)
+	req.word, req.words[len(req.words)-1] = prefix, prefix
+
+	if spec, ok := c.specs[req.command]; ok {
+		return c.generate(spec, req)
+	}
+
+	var candidates []candidate
+
+	files := true
+	if def := c.definition(req.command); def != nil {
+		candidates, files = def.complete(req)
+	}
+	if len(candidates) == 0 && strings.HasPrefix(req.word, "-") {
+		candidates, files = c.helpOptions(req.command), false
+	}
+	if files {
+		candidates = append(candidates, paths(req.word, pathFilter{})...)
+	}
+
+	return candidates
+
 }
 
-// getPIDs reads the /proc directory to find all currently running
-// process IDs. It returns a slice of PID strings, which is used
-// to provide completion suggestions for the "kill" command.
-func getPIDs() []string {
-	proc, _ := os.ReadDir("/proc")
-	var pids []string
-	for _, entry := range proc {
-		if entry.IsDir() {
-			name := entry.Name()
-			if _, err := strconv.Atoi(name); err == nil {
-				pids = append(pids, name)
+// newRequest describes word, the last word of line, for completion.
+func newRequest(line string, word parser.Span) request {
+
+	req := request{word: word.Text, line: line, deadline: time.Now().Add(budget)}
+
+	for _, span := range parser.Lex(line[:word.Start]) {
+		switch span.Kind {
+		case parser.Command:
+			req.command, req.previous = span.Text, span.Text
+			req.words = []string{span.Text}
+		case parser.Argument:
+			req.previous = span.Text
+			req.words = append(req.words, span.Text)
+		case parser.Operator:
+			req.previous = line[span.Start:span.End]
+			if slices.Contains([]string{"&&", "||", "|"}, req.previous) {
+				req.command, req.previous, req.words = "", "", nil
 			}
 		}
 	}
-	return pids
+
+	req.words = append(req.words, req.word)
+
+	return req
+
+}
+
+// suffixes turns the candidates completing prefix, the value of raw, the
+// word before the cursor as it was typed, into items: raw followed by the
+// rest of each candidate, quoted or escaped the way raw is, and by a slash
+// for directories or by a space (closing the quote raw opened, if any) for
+// other words.
+func suffixes(raw, prefix string, candidates []candidate) []Item {
+
+	quote := parser.OpenQuote(raw)
+	dir := prefix[:strings.LastIndexByte(prefix, '/')+1]
+
+	var items []Item
+
+	for _, cand := range candidates {
+
+		if !strings.HasPrefix(cand.text, prefix) {
+			continue
+		}
+
+		suffix := quoteName(cand.text[len(prefix):], quote)
+		switch {
+		case cand.dir:
+			suffix += "/"
+		case quote != 0:
+			suffix += string(quote) + " "
+		default:
+			suffix += " "
+		}
+
+		items = append(items, newItem(raw+suffix, cand, dir))
+
+	}
+
+	return items
+
+}
+
+// approximate returns the candidates, found for dir, whose part after dir
+// contains base, ignoring case, then those containing its runes in order,
+// as items replacing the word with the candidate, escaped.
+func approximate(base, dir string, candidates []candidate) []Item {
+
+	var substrings, subsequences []Item
+	lower := strings.ToLower(base)
+
+	for _, cand := range candidates {
+
+		if !strings.HasPrefix(cand.text, dir) {
+			continue
+		}
+
+		name := strings.ToLower(cand.text[len(dir):])
+		text := quoteName(cand.text, 0)
+		if cand.dir {
+			text += "/"
+		} else {
+			text += " "
+		}
+
+		switch {
+		case strings.Contains(name, lower):
+			substrings = append(substrings, newItem(text, cand, dir))
+		case subsequence(lower, name):
+			subsequences = append(subsequences, newItem(text, cand, dir))
+		}
+
+	}
+
+	return append(substrings, subsequences...)
+
+}
+
+// subsequence reports whether the runes of pattern appear in text in order.
+func subsequence(pattern, text string) bool {
+	runes := []rune(pattern)
+	for _, r := range text {
+		if len(runes) > 0 && r == runes[0] {
+			runes = runes[1:]
+		}
+	}
+	return len(runes) == 0
+}
+
+// newItem returns the item inserting text for cand, a completion of a word
+// whose part up to its last slash is dir.
+func newItem(text string, cand candidate, dir string) Item {
+
+	item := Item{Text: text, Display: strings.TrimPrefix(cand.text, dir), Description: cand.description}
+	if cand.dir {
+		item.Display += "/"
+	}
+	if cand.file {
+		item.Path = expandHome(cand.text)
+	}
+
+	return item
+
+}
+
+// matching returns the names starting with prefix as candidates.
+func matching(names []string, prefix string) []candidate {
+	var candidates []candidate
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, candidate{text: name})
+		}
+	}
+	return candidates
 }
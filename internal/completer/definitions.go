@@ -0,0 +1,42 @@
+package completer
+
+// definition completes the arguments of a command from the completion
+// file another shell would use for it, or as ebash itself knows to.
+type definition interface {
+	// complete returns the candidates completing the word of req, and
+	// whether files should be offered as well.
+	complete(req request) ([]candidate, bool)
+}
+
+// nativeDefinitions are the definitions ebash implements itself, which take
+// precedence over completion files.
+var nativeDefinitions = map[string]definition{
+	"git":         gitDefinition{},
+	"sftp":        hostDefinition{},
+	"ssh":         hostDefinition{},
+	"ssh-copy-id": hostDefinition{},
+}
+
+// definition returns the definition of the command name: its native
+// definition, or the one found among the completion files of fish, then
+// among those of bash-completion, or nil if there is none. The lookup is
+// done once per command.
+func (c *Completer) definition(name string) definition {
+
+	if def, ok := c.definitions[name]; ok {
+		return def
+	}
+
+	def, ok := nativeDefinitions[name]
+	if !ok {
+		def = findFishDefinition(name)
+	}
+	if def == nil {
+		def = findBashDefinition(name)
+	}
+
+	c.definitions[name] = def
+
+	return def
+
+}
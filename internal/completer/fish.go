@@ -0,0 +1,284 @@
+package completer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"Ebash/internal/parser"
+)
+
+// fishCompletionDirs lists the directories fish loads the completion file
+// of a command from, in order of preference.
+var fishCompletionDirs = []string{
+	"~/.config/fish/completions",
+	"/etc/fish/completions",
+	"/usr/local/share/fish/vendor_completions.d",
+	"/usr/share/fish/vendor_completions.d",
+	"/usr/local/share/fish/completions",
+	"/usr/share/fish/completions",
+}
+
+// fishTranslation matches the (_ "text") substitutions fish completion
+// files use to translate their descriptions.
+var fishTranslation = regexp.MustCompile(`\(_ ("[^"]*"|'[^']*')\)`)
+
+// fishCompletion is one "complete -c" declaration of a fish completion
+// file.
+type fishCompletion struct {
+	options     []string    // options it describes, with their dashes ("-s", "--long", "-old")
+	arguments   []candidate // words it offers (-a), as arguments or as the parameter of its options
+	description string      // description of the options (-d)
+	condition   string      // condition under which it applies (-n)
+	noFiles     bool        // files are not offered along with its arguments (-f, -x)
+	parameter   bool        // its options take a parameter (-r, -x)
+}
+
+// fishDefinition completes the arguments of a command from the
+// declarations of its fish completion file.
+type fishDefinition []fishCompletion
+
+// findFishDefinition reads the fish completion file of the command name.
+// Returns nil if it has none, or none that ebash understands.
+func findFishDefinition(name string) definition {
+
+	path := findFile(fishCompletionDirs, name+".fish")
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var def fishDefinition
+	var line strings.Builder
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+
+		text := scanner.Text()
+		if strings.HasSuffix(text, `\`) {
+			line.WriteString(strings.TrimSuffix(text, `\`))
+			continue
+		}
+		line.WriteString(text)
+
+		if completion, ok := parseFishComplete(line.String(), name); ok {
+			def = append(def, completion)
+		}
+		line.Reset()
+
+	}
+
+	if len(def) == 0 {
+		return nil
+	}
+
+	return def
+
+}
+
+// parseFishComplete parses a "complete -c name ..." declaration. Other
+// lines, declarations for other commands and those erasing completions are
+// skipped.
+func parseFishComplete(line, name string) (fishCompletion, bool) {
+
+	var words []string
+	line = fishTranslation.ReplaceAllString(strings.TrimSpace(line), "$1")
+
+	for _, span := range parser.Lex(line) {
+		if span.Kind == parser.Command || span.Kind == parser.Argument {
+			words = append(words, span.Text)
+		}
+	}
+
+	if len(words) < 2 || words[0] != "complete" {
+		return fishCompletion{}, false
+	}
+
+	var completion fishCompletion
+	var command string
+
+	for i := 1; i < len(words); i++ {
+
+		word := words[i]
+		var flags string
+
+		switch {
+		case strings.HasPrefix(word, "--"):
+			option, value, attached := strings.Cut(word[2:], "=")
+			flags = map[string]string{
+				"command": "c", "short-option": "s", "long-option": "l", "old-option": "o",
+				"arguments": "a", "description": "d", "condition": "n", "no-files": "f",
+				"require-parameter": "r", "exclusive": "x", "erase": "e",
+			}[option]
+			if attached {
+				words = slices.Insert(words, i+1, value)
+			}
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			flags = word[1:]
+		default:
+			continue
+		}
+
+		for j := 0; j < len(flags); j++ {
+
+			flag := flags[j]
+
+			switch flag {
+			case 'f':
+				completion.noFiles = true
+				continue
+			case 'r':
+				completion.parameter = true
+				continue
+			case 'x':
+				completion.noFiles, completion.parameter = true, true
+				continue
+			case 'e':
+				return fishCompletion{}, false
+			case 'c', 's', 'l', 'o', 'a', 'd', 'n':
+			default:
+				continue
+			}
+
+			value := flags[j+1:]
+			if value == "" && i+1 < len(words) {
+				i++
+				value = words[i]
+			}
+
+			switch flag {
+			case 'c':
+				command = value
+			case 's':
+				completion.options = append(completion.options, "-"+value)
+			case 'l':
+				completion.options = append(completion.options, "--"+value)
+			case 'o':
+				completion.options = append(completion.options, "-"+value)
+			case 'a':
+				completion.arguments = append(completion.arguments, fishArguments(value)...)
+			case 'd':
+				completion.description = value
+			case 'n':
+				completion.condition = value
+			}
+
+			break
+
+		}
+
+	}
+
+	return completion, command == name
+
+}
+
+// fishArguments splits the argument list of a declaration into words with
+// their descriptions, which follow a tab. Command substitutions and
+// variables, which only fish can expand, are left out.
+func fishArguments(list string) []candidate {
+
+	var arguments []candidate
+
+	for _, line := range strings.Split(list, "\n") {
+
+		text, description, described := strings.Cut(line, "\t")
+		if described {
+			arguments = append(arguments, candidate{text: text, description: description})
+			continue
+		}
+
+		for _, word := range strings.Fields(text) {
+			if !strings.ContainsAny(word, "()$") {
+				arguments = append(arguments, candidate{text: word})
+			}
+		}
+
+	}
+
+	return arguments
+
+}
+
+// complete offers the options of the declarations that apply when req.word
+// starts with a dash, the parameters of the option before it when that
+// option takes one, and the arguments of the declarations without options
+// otherwise. Files are offered along with the arguments unless a
+// declaration says not to.
+func (def fishDefinition) complete(req request) ([]candidate, bool) {
+
+	var candidates []candidate
+	files := true
+
+	for _, completion := range def {
+		if completion.parameter && slices.Contains(completion.options, req.previous) {
+			return completion.arguments, !completion.noFiles
+		}
+	}
+
+	for _, completion := range def {
+
+		if !fishCondition(completion.condition, req.words[1:len(req.words)-1]) {
+			continue
+		}
+
+		if strings.HasPrefix(req.word, "-") {
+			for _, option := range completion.options {
+				candidates = append(candidates, candidate{text: option, description: completion.description})
+			}
+			continue
+		}
+
+		if len(completion.options) == 0 {
+			candidates = append(candidates, completion.arguments...)
+			files = files && !completion.noFiles
+		}
+
+	}
+
+	return candidates, files && !strings.HasPrefix(req.word, "-")
+
+}
+
+// fishCondition evaluates the condition of a declaration, given the words
+// of the command between its name and the word being completed. Only the
+// conditions fish completion files use to describe subcommands are
+// understood: __fish_use_subcommand, __fish_seen_subcommand_from and their
+// negations with "not". Other conditions are taken as false.
+func fishCondition(condition string, words []string) bool {
+	value, known := evaluateFishCondition(strings.TrimSpace(condition), words)
+	return known && value
+}
+
+// evaluateFishCondition returns the value of condition for words, and
+// whether the condition is understood at all.
+func evaluateFishCondition(condition string, words []string) (bool, bool) {
+
+	if condition == "" {
+		return true, true
+	}
+
+	if rest, negated := strings.CutPrefix(condition, "not "); negated {
+		value, known := evaluateFishCondition(strings.TrimSpace(rest), words)
+		return !value, known
+	}
+
+	fields := strings.Fields(condition)
+
+	switch fields[0] {
+	case "__fish_use_subcommand":
+		return !slices.ContainsFunc(words, func(word string) bool { return !strings.HasPrefix(word, "-") }), true
+	case "__fish_seen_subcommand_from":
+		return slices.ContainsFunc(words, func(word string) bool { return slices.Contains(fields[1:], word) }), true
+	}
+
+	return false, false
+
+}
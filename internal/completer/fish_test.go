@@ -0,0 +1,111 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// requestFor returns the request completing the last of words, the words
+// of a command line up to the cursor.
+func requestFor(words ...string) request {
+	req := request{command: words[0], word: words[len(words)-1], words: words}
+	if len(words) > 1 {
+		req.previous = words[len(words)-2]
+	}
+	return req
+}
+
+// texts returns the texts of candidates, with the description of each
+// after a tab when it has one.
+func texts(candidates []candidate) []string {
+	var texts []string
+	for _, cand := range candidates {
+		if cand.description != "" {
+			texts = append(texts, cand.text+"\t"+cand.description)
+		} else {
+			texts = append(texts, cand.text)
+		}
+	}
+	return texts
+}
+
+func TestFishDefinition(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".config", "fish", "completions")
+	fixture, err := os.ReadFile(filepath.Join("testdata", "svc.fish"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "svc.fish"), fixture, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.fish"), []byte("complete -c svc -l wrong\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if def := findFishDefinition("other"); def != nil {
+		t.Errorf("findFishDefinition(other) = %v, want nil for a file declaring nothing for other", def)
+	}
+
+	def := findFishDefinition("svc")
+	if def == nil {
+		t.Fatal("findFishDefinition(svc) = nil")
+	}
+
+	tests := []struct {
+		words      []string
+		candidates []string
+		files      bool
+	}{
+		{[]string{"svc", ""}, []string{"start", "stop", "status"}, false},
+		{[]string{"svc", "-"}, []string{
+			"--config\tConfiguration file",
+			"--dry-run\tOnly show what would be done",
+			"-old\tOld-style option",
+			"--verbose\tBe verbose",
+		}, false},
+		{[]string{"svc", "start", "--"}, []string{
+			"-f\tStart even if running",
+			"--force\tStart even if running",
+			"--config\tConfiguration file",
+			"-old\tOld-style option",
+			"--verbose\tBe verbose",
+		}, false},
+		{[]string{"svc", "--config", ""}, []string{"a.conf", "b.conf"}, true},
+	}
+
+	for _, test := range tests {
+		candidates, files := def.complete(requestFor(test.words...))
+		if got := texts(candidates); !slices.Equal(got, test.candidates) || files != test.files {
+			t.Errorf("complete(%q) = %q, %v, want %q, %v", test.words, got, files, test.candidates, test.files)
+		}
+	}
+
+}
+
+func TestFishArguments(t *testing.T) {
+
+	tests := []struct {
+		list      string
+		arguments []string
+	}{
+		{"start stop", []string{"start", "stop"}},
+		{"one\tFirst\ntwo\tSecond", []string{"one\tFirst", "two\tSecond"}},
+		{"(__fish_print_hostnames) $hosts local", []string{"local"}},
+	}
+
+	for _, test := range tests {
+		if got := texts(fishArguments(test.list)); !slices.Equal(got, test.arguments) {
+			t.Errorf("fishArguments(%q) = %q, want %q", test.list, got, test.arguments)
+		}
+	}
+
+}
@@ -0,0 +1,386 @@
+package completer
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// gitSubcommands are the git subcommands offered as the first argument of
+// git, along with the aliases of the git configuration.
+var gitSubcommands = []candidate{
+	{text: "add", description: "Add file contents to the index"},
+	{text: "bisect", description: "Find the commit that introduced a bug"},
+	{text: "blame", description: "Show who last modified each line of a file"},
+	{text: "branch", description: "List, create, or delete branches"},
+	{text: "checkout", description: "Switch branches or restore working tree files"},
+	{text: "cherry-pick", description: "Apply the changes introduced by some existing commits"},
+	{text: "clean", description: "Remove untracked files from the working tree"},
+	{text: "clone", description: "Clone a repository into a new directory"},
+	{text: "commit", description: "Record changes to the repository"},
+	{text: "config", description: "Get and set repository or global options"},
+	{text: "describe", description: "Give an object a human readable name"},
+	{text: "diff", description: "Show changes between commits, commit and working tree, etc"},
+	{text: "fetch", description: "Download objects and refs from another repository"},
+	{text: "format-patch", description: "Prepare patches for e-mail submission"},
+	{text: "grep", description: "Print lines matching a pattern"},
+	{text: "help", description: "Display help information about git"},
+	{text: "init", description: "Create an empty git repository"},
+	{text: "log", description: "Show commit logs"},
+	{text: "merge", description: "Join two or more development histories together"},
+	{text: "mv", description: "Move or rename a file, a directory, or a symlink"},
+	{text: "pull", description: "Fetch from and integrate with another repository or branch"},
+	{text: "push", description: "Update remote refs along with associated objects"},
+	{text: "rebase", description: "Reapply commits on top of another base tip"},
+	{text: "reflog", description: "Manage reflog information"},
+	{text: "remote", description: "Manage set of tracked repositories"},
+	{text: "reset", description: "Reset current HEAD to the specified state"},
+	{text: "restore", description: "Restore working tree files"},
+	{text: "revert", description: "Revert some existing commits"},
+	{text: "rm", description: "Remove files from the working tree and from the index"},
+	{text: "show", description: "Show various types of objects"},
+	{text: "stash", description: "Stash the changes in a dirty working directory away"},
+	{text: "status", description: "Show the working tree status"},
+	{text: "submodule", description: "Initialize, update or inspect submodules"},
+	{text: "switch", description: "Switch branches"},
+	{text: "tag", description: "Create, list, delete or verify tags"},
+	{text: "worktree", description: "Manage multiple working trees"},
+}
+
+// gitRefCommands lists the git subcommands whose arguments are branches,
+// tags and other refs.
+var gitRefCommands = []string{
+	"branch", "checkout", "cherry-pick", "describe", "diff", "format-patch", "log",
+	"merge", "rebase", "reflog", "reset", "revert", "show", "switch", "tag",
+}
+
+// gitRemoteCommands are the subcommands of "git remote".
+var gitRemoteCommands = []string{"add", "get-url", "prune", "remove", "rename", "set-head", "set-url", "show", "update"}
+
+// gitParameterOptions are the options of git itself that take a parameter.
+var gitParameterOptions = []string{"-C", "-c", "--git-dir", "--work-tree", "--namespace"}
+
+// gitDefinition completes the arguments of git: its subcommands and
+// aliases, the refs of the repository for the subcommands that take refs,
+// its remotes for push, pull, fetch and remote, and the changed files for
+// add and restore. Refs, remotes and aliases are read from the .git
+// directory without running git.
+type gitDefinition struct{}
+
+// complete offers the completions of the word of req, as documented on
+// gitDefinition. Options are left to the manual page of git, or to its
+// --help output when RunHelp is set (shopt complete_help).
+func (gitDefinition) complete(req request) ([]candidate, bool) {
+
+	if strings.HasPrefix(req.word, "-") {
+		return nil, false
+	}
+
+	dir := "."
+	subcommand := ""
+	var args []string
+
+	words := req.words[1 : len(req.words)-1]
+	for i := 0; i < len(words); i++ {
+		switch {
+		case subcommand != "":
+			args = append(args, words[i])
+		case slices.Contains(gitParameterOptions, words[i]) && i+1 < len(words):
+			if words[i] == "-C" {
+				dir = expandHome(words[i+1])
+			}
+			i++
+		case !strings.HasPrefix(words[i], "-"):
+			subcommand = words[i]
+		}
+	}
+
+	gitDir := findGitDir(dir)
+
+	if subcommand == "" {
+		return append(slices.Clone(gitSubcommands), gitAliases(gitDir)...), false
+	}
+
+	positional := 0
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			positional++
+		}
+	}
+
+	staged := slices.Contains(args, "--staged") || slices.Contains(args, "-S")
+
+	switch {
+	case subcommand == "add" || subcommand == "restore":
+		return gitChangedFiles(req, dir, subcommand == "restore", staged), false
+	case slices.Contains(args, "--"):
+		return nil, true
+	case subcommand == "remote" && positional == 0:
+		return matching(gitRemoteCommands, ""), false
+	case subcommand == "remote":
+		return gitRemotes(gitDir), false
+	case subcommand == "push" || subcommand == "pull" || subcommand == "fetch":
+		if positional == 0 {
+			return gitRemotes(gitDir), false
+		}
+		return gitRefs(gitDir), false
+	case slices.Contains(gitRefCommands, subcommand):
+		return gitRefs(gitDir), false
+	}
+
+	return nil, true
+
+}
+
+// findGitDir returns the git directory of the repository dir is in, found
+// the way git does: in the nearest .git, a directory or a file naming it.
+// Returns "" outside repositories.
+func findGitDir(dir string) string {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+
+		path := filepath.Join(dir, ".git")
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				return path
+			}
+			if data, err := os.ReadFile(path); err == nil {
+				if target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: "); ok {
+					if !filepath.IsAbs(target) {
+						target = filepath.Join(dir, target)
+					}
+					return target
+				}
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+
+	}
+
+}
+
+// gitCommonDir returns the directory holding the refs and configuration of
+// the repository of gitDir, which differs from gitDir in linked worktrees.
+func gitCommonDir(gitDir string) string {
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+
+	common := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+
+	return common
+
+}
+
+// gitRefs returns the local branches, remote-tracking branches and tags of
+// the repository of gitDir, read from its loose refs and packed-refs.
+func gitRefs(gitDir string) []candidate {
+
+	if gitDir == "" {
+		return nil
+	}
+
+	common := gitCommonDir(gitDir)
+	kinds := []struct{ prefix, description string }{
+		{"refs/heads/", "branch"},
+		{"refs/remotes/", "remote branch"},
+		{"refs/tags/", "tag"},
+	}
+
+	var candidates []candidate
+	seen := make(map[string]bool)
+
+	add := func(ref string) {
+		for _, kind := range kinds {
+			name, ok := strings.CutPrefix(ref, kind.prefix)
+			if ok && name != "" && !strings.HasSuffix(name, "/HEAD") && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, candidate{text: name, description: kind.description})
+			}
+		}
+	}
+
+	for _, kind := range kinds {
+		root := filepath.Join(common, kind.prefix)
+		_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				if rel, err := filepath.Rel(common, path); err == nil {
+					add(filepath.ToSlash(rel))
+				}
+			}
+			return nil
+		})
+	}
+
+	if file, err := os.Open(filepath.Join(common, "packed-refs")); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) == 2 && !strings.HasPrefix(fields[0], "#") {
+				add(fields[1])
+			}
+		}
+	}
+
+	return candidates
+
+}
+
+// gitRemotes returns the remotes declared in the configuration of the
+// repository of gitDir.
+func gitRemotes(gitDir string) []candidate {
+
+	if gitDir == "" {
+		return nil
+	}
+
+	var candidates []candidate
+
+	for _, section := range gitConfigSections(filepath.Join(gitCommonDir(gitDir), "config")) {
+		if name, ok := strings.CutPrefix(section.name, "remote "); ok {
+			candidates = append(candidates, candidate{text: strings.Trim(name, `"`), description: section.values["url"]})
+		}
+	}
+
+	return candidates
+
+}
+
+// gitAliases returns the aliases of the configuration of the user and of
+// the repository of gitDir, described by what they stand for.
+func gitAliases(gitDir string) []candidate {
+
+	files := []string{expandHome("~/.gitconfig"), expandHome("~/.config/git/config")}
+	if gitDir != "" {
+		files = append(files, filepath.Join(gitCommonDir(gitDir), "config"))
+	}
+
+	var candidates []candidate
+
+	for _, file := range files {
+		for _, section := range gitConfigSections(file) {
+			if section.name != "alias" {
+				continue
+			}
+			for name, value := range section.values {
+				candidates = append(candidates, candidate{text: name, description: value})
+			}
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int { return strings.Compare(a.text, b.text) })
+
+	return candidates
+
+}
+
+// gitConfigSection is a section of a git configuration file.
+type gitConfigSection struct {
+	name   string            // name of the section, with its subsection ("remote \"origin\"")
+	values map[string]string // its variables, by lower-case name
+}
+
+// gitConfigSections reads the sections of the git configuration file at
+// path. Only the "name = value" form of variables is understood; includes
+// are not followed.
+func gitConfigSections(path string) []gitConfigSection {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var sections []gitConfigSection
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			sections = append(sections, gitConfigSection{name: strings.TrimSpace(line[1 : len(line)-1]), values: make(map[string]string)})
+		case len(sections) > 0 && line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, ";"):
+			name, value, _ := strings.Cut(line, "=")
+			sections[len(sections)-1].values[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+
+	}
+
+	return sections
+
+}
+
+// gitChangedFiles returns the files git add or git restore applies to
+// under dir, relative to it: modified and untracked files for add,
+// modified files for restore, or staged ones when staged is set. Like
+// paths, it completes the word of req one directory at a time. It runs git,
+// until the deadline of req, since the changes can only be known from the
+// index.
+func gitChangedFiles(req request, dir string, restore, staged bool) []candidate {
+
+	ctx, cancel := context.WithDeadline(context.Background(), req.deadline)
+	defer cancel()
+
+	args := []string{"ls-files", "-z", "--modified", "--others", "--exclude-standard"}
+	switch {
+	case restore && staged:
+		args = []string{"diff", "--cached", "--name-only", "--relative", "-z"}
+	case restore:
+		args = []string{"ls-files", "-z", "--modified"}
+	}
+
+	cmd := providerCommand(ctx, "git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	base := req.word[:strings.LastIndexByte(req.word, '/')+1]
+
+	var candidates []candidate
+	seen := make(map[string]bool)
+
+	for _, path := range strings.Split(string(output), "\x00") {
+
+		if !strings.HasPrefix(path, base) || path == "" {
+			continue
+		}
+
+		cand := candidate{text: path}
+		if slash := strings.IndexByte(path[len(base):], '/'); slash >= 0 {
+			cand = candidate{text: path[:len(base)+slash], dir: true}
+		}
+
+		if !seen[cand.text] {
+			seen[cand.text] = true
+			candidates = append(candidates, cand)
+		}
+
+	}
+
+	return candidates
+
+}
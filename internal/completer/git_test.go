@@ -0,0 +1,158 @@
+package completer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// gitRepository creates a repository with branches, tags, a remote, an
+// alias, a linked worktree and changed files, some of its refs packed.
+// Returns the directories of the repository and of the worktree.
+func gitRepository(t *testing.T) (string, string) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := filepath.Join(t.TempDir(), "repo")
+	worktree := filepath.Join(filepath.Dir(repo), "worktree")
+
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n\tname = Test\n\temail = test@example.com\n[alias]\n\tst = status\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v\n%s", args, err, output)
+		}
+	}
+
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	git("init", "-q", "-b", "main")
+	write("a.txt", "a\n")
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "first")
+	git("branch", "feature/x")
+	git("tag", "v1")
+	git("remote", "add", "origin", "https://example.com/repo.git")
+	git("update-ref", "refs/remotes/origin/main", "HEAD")
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/main")
+	git("config", "alias.co", "checkout")
+	git("pack-refs", "--all")
+	git("branch", "loose")
+	git("worktree", "add", "-q", "-b", "linked", worktree)
+
+	write("a.txt", "changed\n")
+	write("sub/new.txt", "new\n")
+	write("c.txt", "staged\n")
+	git("add", "c.txt")
+
+	return repo, worktree
+
+}
+
+func TestGitDefinition(t *testing.T) {
+
+	repo, worktree := gitRepository(t)
+
+	refs := []string{
+		"feature/x\tbranch",
+		"linked\tbranch",
+		"loose\tbranch",
+		"main\tbranch",
+		"origin/main\tremote branch",
+		"v1\ttag",
+	}
+
+	tests := []struct {
+		words      []string
+		candidates []string // sorted
+		files      bool
+	}{
+		{[]string{"git", "-C", repo, "checkout", ""}, refs, false},
+		{[]string{"git", "-C", worktree, "merge", ""}, refs, false},
+		{[]string{"git", "-C", repo, "push", ""}, []string{"origin\thttps://example.com/repo.git"}, false},
+		{[]string{"git", "-C", repo, "push", "origin", ""}, refs, false},
+		{[]string{"git", "-C", repo, "remote", "show", ""}, []string{"origin\thttps://example.com/repo.git"}, false},
+		{[]string{"git", "-C", repo, "add", ""}, []string{"a.txt", "sub"}, false},
+		{[]string{"git", "-C", repo, "add", "sub/"}, []string{"sub/new.txt"}, false},
+		{[]string{"git", "-C", repo, "restore", ""}, []string{"a.txt"}, false},
+		{[]string{"git", "-C", repo, "restore", "--staged", ""}, []string{"c.txt"}, false},
+		{[]string{"git", "-C", repo, "log", "--", ""}, nil, true},
+		{[]string{"git", "-C", repo, "checkout", "-"}, nil, false},
+	}
+
+	for _, test := range tests {
+
+		req := requestFor(test.words...)
+		req.deadline = time.Now().Add(budget)
+
+		candidates, files := gitDefinition{}.complete(req)
+		got := texts(candidates)
+		slices.Sort(got)
+
+		if !slices.Equal(got, test.candidates) || files != test.files {
+			t.Errorf("complete(%q) = %q, %v, want %q, %v", test.words[3:], got, files, test.candidates, test.files)
+		}
+
+	}
+
+	candidates, _ := gitDefinition{}.complete(requestFor("git", "-C", repo, ""))
+	got := texts(candidates)
+	for _, want := range []string{"co\tcheckout", "st\tstatus", "commit\tRecord changes to the repository"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("subcommands of git = %q, want them to include %q", got, want)
+		}
+	}
+
+}
+
+func TestGitConfigSections(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config")
+	config := "# comment\n[core]\n\tbare = false\n[remote \"upstream\"]\n\tURL = git@example.com:repo.git\n\tfetch = +refs/heads/*:refs/remotes/upstream/*\n; other comment\n[alias]\n\tlg = log --oneline\n"
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sections := gitConfigSections(path)
+
+	var names []string
+	for _, section := range sections {
+		names = append(names, section.name)
+	}
+
+	if want := []string{"core", `remote "upstream"`, "alias"}; !slices.Equal(names, want) {
+		t.Fatalf("sections = %q, want %q", names, want)
+	}
+	if url := sections[1].values["url"]; url != "git@example.com:repo.git" {
+		t.Errorf("url of upstream = %q", url)
+	}
+	if alias := sections[2].values["lg"]; alias != "log --oneline" {
+		t.Errorf("alias lg = %q", alias)
+	}
+
+}
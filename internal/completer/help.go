@@ -0,0 +1,367 @@
+package completer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// manDirs lists the directories holding the sources of the manual pages
+// whose options are offered when --help tells nothing.
+var manDirs = []string{
+	"/usr/local/share/man/man1",
+	"/usr/share/man/man1",
+	"/usr/local/share/man/man8",
+	"/usr/share/man/man8",
+}
+
+// helpTimeout bounds the time "command --help" may take.
+const helpTimeout = time.Second
+
+// optionName matches the options worth offering: a dash or two followed by
+// a name.
+var optionName = regexp.MustCompile(`^--?[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// troffEscape matches the font changes and other escapes of manual page
+// sources that carry no text.
+var troffEscape = regexp.MustCompile(`\\f(\[[^]]*\]|\(..|.)|\\[&^|:]|\\s[-+]?[0-9]`)
+
+// mdocMacro matches the names of the macros of manual pages written with
+// the mdoc macros, such as ".Fl" and ".Xr", and of no man(7) macro.
+var mdocMacro = regexp.MustCompile(`^\.[A-Z][a-z][a-z]?$`)
+
+// troffArgument matches an argument of a macro of a manual page source: a
+// quoted string or a word.
+var troffArgument = regexp.MustCompile(`"[^"]*"|[^\s"]+`)
+
+// helpOptions are the options of an executable with their descriptions, as
+// cached in memory and on disk.
+type helpOptions struct {
+	Path    string      `json:"path"`           // path of the executable
+	ModTime time.Time   `json:"mtime"`          // modification time of the executable when its options were read
+	Help    bool        `json:"help,omitempty"` // whether "path --help" was run to read them
+	Options []helpEntry `json:"options"`        // its options
+}
+
+// helpEntry is an option and its description.
+type helpEntry struct {
+	Option      string `json:"option"`
+	Description string `json:"description,omitempty"`
+}
+
+// helpOptions returns the options of the command name, an executable found
+// in an absolute directory of $PATH, read from its manual page. When
+// c.RunHelp is set they are read from the output of "name --help" first, so
+// that only programs installed in $PATH, never one in the current directory
+// or named by a path, are run while the user types. The options are cached
+// in memory and in the cache directory of ebash, and read again only when
+// the executable changes or RunHelp is set for options read without it.
+func (c *Completer) helpOptions(name string) []candidate {
+
+	if strings.ContainsRune(name, '/') {
+		return nil
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil || !filepath.IsAbs(path) {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	current := func(cached helpOptions) bool {
+		return cached.ModTime.Equal(info.ModTime()) && (cached.Help || !c.RunHelp)
+	}
+
+	cached, ok := c.options[path]
+	if !ok || !current(cached) {
+		cached, ok = readHelpCache(path)
+	}
+
+	if !ok || !current(cached) {
+		cached = helpOptions{Path: path, ModTime: info.ModTime(), Help: c.RunHelp}
+		if c.RunHelp {
+			cached.Options = parseHelp(runHelp(path))
+		}
+		if len(cached.Options) == 0 {
+			cached.Options = parseHelp(manText(name))
+		}
+		writeHelpCache(cached)
+	}
+
+	c.options[path] = cached
+
+	candidates := make([]candidate, 0, len(cached.Options))
+	for _, entry := range cached.Options {
+		candidates = append(candidates, candidate{text: entry.Option, description: entry.Description})
+	}
+
+	return candidates
+
+}
+
+// runHelp returns what "path --help" prints on its standard output and
+// error, or "" if it does not finish within helpTimeout.
+func runHelp(path string) string {
+
+	ctx, cancel := context.WithTimeout(context.Background(), helpTimeout)
+	defer cancel()
+
+	output, _ := providerCommand(ctx, path, "--help").CombinedOutput()
+	if ctx.Err() != nil {
+		return ""
+	}
+
+	return string(output)
+
+}
+
+// parseHelp extracts the options described in text, the output of --help
+// or a manual page turned into text by manText. Option lines list the
+// options, separated by commas and followed by their parameter, then the
+// description after two blanks or more, or on the next line.
+func parseHelp(text string) []helpEntry {
+
+	var entries []helpEntry
+	seen := make(map[string]bool)
+
+	lines := strings.Split(text, "\n")
+
+	for i, line := range lines {
+
+		trimmed := strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+
+		options, description, _ := strings.Cut(trimmed, "  ")
+		description = strings.TrimSpace(description)
+		if description == "" && i+1 < len(lines) {
+			if next := strings.TrimSpace(lines[i+1]); !strings.HasPrefix(next, "-") {
+				description = next
+			}
+		}
+
+		for _, option := range strings.Split(options, ",") {
+			option = strings.TrimSpace(option)
+			if end := strings.IndexAny(option, " =[<"); end >= 0 {
+				option = option[:end]
+			}
+			if optionName.MatchString(option) && !seen[option] {
+				seen[option] = true
+				entries = append(entries, helpEntry{Option: option, Description: description})
+			}
+		}
+
+	}
+
+	return entries
+
+}
+
+// manText turns the options described in the manual page of the command
+// name into lines in the format of --help output: every ".TP" paragraph
+// whose tag is an option becomes the tag followed by the first sentence of
+// the paragraph, and so does every ".It Fl" item of pages written with the
+// mdoc macros. Returns "" if there is no manual page.
+func manText(name string) string {
+
+	source, closer := openManPage(name)
+	if source == nil {
+		return ""
+	}
+	defer closer.Close()
+
+	var text strings.Builder
+	var tag string
+	var paragraph []string
+
+	flush := func() {
+		if strings.HasPrefix(tag, "-") {
+			description := strings.Join(paragraph, " ")
+			if end := strings.Index(description, ". "); end >= 0 {
+				description = description[:end+1]
+			}
+			text.WriteString("  " + tag + "  " + description + "\n")
+		}
+		tag, paragraph = "", nil
+	}
+
+	scanner := bufio.NewScanner(source)
+	for scanner.Scan() {
+
+		line := scanner.Text()
+		macro, _, _ := strings.Cut(line, " ")
+		_, font := fontMacros[macro]
+
+		switch {
+		case macro == ".TP":
+			flush()
+			tag = "\n"
+		case tag == "\n":
+			tag = cleanTroff(line)
+		case macro == ".It":
+			flush()
+			tag = cleanMdoc(line, name)
+		case tag == "":
+		case mdocMacro.MatchString(macro) && macro != ".El" && macro != ".Sh":
+			if cleaned := cleanMdoc(line, name); cleaned != "" {
+				paragraph = append(paragraph, cleaned)
+			}
+		case !strings.HasPrefix(line, ".") || font:
+			if cleaned := cleanTroff(line); cleaned != "" {
+				paragraph = append(paragraph, cleaned)
+			}
+		default:
+			flush()
+		}
+
+	}
+
+	flush()
+
+	return text.String()
+
+}
+
+// openManPage opens the source of the manual page of the command name,
+// compressed or not, in sections 1 and 8. Returns nil if there is none.
+func openManPage(name string) (io.Reader, io.Closer) {
+
+	for _, dir := range manDirs {
+		for _, section := range []string{"1", "8"} {
+			path := filepath.Join(dir, name+"."+section)
+			if file, err := os.Open(path + ".gz"); err == nil {
+				reader, err := gzip.NewReader(file)
+				if err != nil {
+					file.Close()
+					return nil, nil
+				}
+				return reader, file
+			}
+			if file, err := os.Open(path); err == nil {
+				return file, file
+			}
+		}
+	}
+
+	return nil, nil
+
+}
+
+// fontMacros maps the font macros of manual pages to the separator of
+// their arguments: the alternating ones (.BR, .IR...) join their arguments
+// without blanks.
+var fontMacros = map[string]string{
+	".B": " ", ".I": " ", ".SM": " ", ".SB": " ",
+	".BR": "", ".BI": "", ".IR": "", ".IB": "", ".RB": "", ".RI": "",
+}
+
+// cleanTroff returns the text of a line of a manual page source, without
+// its font macro and escapes.
+func cleanTroff(line string) string {
+
+	if macro, rest, _ := strings.Cut(line, " "); strings.HasPrefix(line, ".") {
+		var args []string
+		for _, field := range troffArgument.FindAllString(rest, -1) {
+			args = append(args, strings.Trim(field, `"`))
+		}
+		line = strings.Join(args, fontMacros[macro])
+	}
+
+	line = troffEscape.ReplaceAllString(line, "")
+	line = strings.NewReplacer(`\-`, "-", `\(em`, "-", `\(en`, "-", `\*(lq`, `"`, `\*(rq`, `"`, `\e`, `\`, `\ `, " ").Replace(line)
+
+	return strings.Join(strings.Fields(line), " ")
+
+}
+
+// cleanMdoc returns the text of a line of a manual page source written with
+// the mdoc macros: "Fl" prefixes the next word with a dash, "Nm" stands for
+// name, the command, and other macros are left out.
+func cleanMdoc(line, name string) string {
+
+	var words []string
+	flag := false
+
+	for i, word := range strings.Fields(cleanTroff(strings.TrimPrefix(line, "."))) {
+		switch {
+		case word == "Fl":
+			flag = true
+		case word == "Nm":
+			words = append(words, name)
+		case i == 0 || mdocMacro.MatchString("."+word):
+		case flag:
+			words = append(words, "-"+word)
+			flag = false
+		default:
+			words = append(words, word)
+		}
+	}
+
+	return strings.Join(words, " ")
+
+}
+
+// helpCacheFile returns the file the options of the executable at path are
+// cached in, under the user's cache directory.
+func helpCacheFile(path string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ebash", "options", url.PathEscape(path)+".json")
+}
+
+// readHelpCache reads the options of the executable at path from the cache.
+func readHelpCache(path string) (helpOptions, bool) {
+
+	var cached helpOptions
+
+	file := helpCacheFile(path)
+	if file == "" {
+		return cached, false
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil || json.Unmarshal(data, &cached) != nil || cached.Path != path {
+		return cached, false
+	}
+
+	return cached, true
+
+}
+
+// writeHelpCache stores options in the cache. Failures are ignored: the
+// options are then read again the next time ebash starts.
+func writeHelpCache(options helpOptions) {
+
+	file := helpCacheFile(options.Path)
+	if file == "" {
+		return
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return
+	}
+
+	_ = os.WriteFile(file, data, 0o644)
+
+}
@@ -0,0 +1,120 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// entries returns the options of entries, each followed by its description
+// after a tab.
+func entries(options []helpEntry) []string {
+	var entries []string
+	for _, entry := range options {
+		entries = append(entries, entry.Option+"\t"+entry.Description)
+	}
+	return entries
+}
+
+func TestParseHelp(t *testing.T) {
+
+	help, err := os.ReadFile(filepath.Join("testdata", "frob-help.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"-a\tdo not ignore entries starting with .",
+		"--all\tdo not ignore entries starting with .",
+		"--block-size\twith -l, scale sizes by SIZE",
+		"-C\tlist entries by columns",
+		"--color\tcolor the output WHEN",
+		"-I\tdo not list entries matching PATTERN",
+		"--ignore\tdo not list entries matching PATTERN",
+		"--help\tdisplay this help and exit",
+		"-1\tlist one file per line",
+	}
+
+	if got := entries(parseHelp(string(help))); !slices.Equal(got, want) {
+		t.Errorf("parseHelp(frob --help) =\n%q\nwant\n%q", got, want)
+	}
+
+}
+
+func TestManText(t *testing.T) {
+
+	defer func(dirs []string) { manDirs = dirs }(manDirs)
+	manDirs = []string{filepath.Join("testdata", "man1")}
+
+	tests := []struct {
+		name    string
+		options []string
+	}{
+		{"frob", []string{
+			"-a\tDo not ignore entries starting with a dot.",
+			"--all\tDo not ignore entries starting with a dot.",
+			"--width\tAssume a screen N columns wide.",
+		}},
+		{"zap", []string{
+			"-q\tBe quiet.",
+			"-o\tWrite to file .",
+		}},
+		{"missing", nil},
+	}
+
+	for _, test := range tests {
+		if got := entries(parseHelp(manText(test.name))); !slices.Equal(got, test.options) {
+			t.Errorf("options of the manual page of %s = %q, want %q", test.name, got, test.options)
+		}
+	}
+
+}
+
+func TestHelpOptionsRunsOnlyPathCommands(t *testing.T) {
+
+	defer func(dirs []string) { manDirs = dirs }(manDirs)
+	manDirs = nil
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	bin, cwd := t.TempDir(), t.TempDir()
+	marker := filepath.Join(t.TempDir(), "ran")
+	script := "#!/bin/sh\necho \"$0\" >> " + marker + "\necho '  -q, --quiet  say nothing'\n"
+	for _, path := range []string{filepath.Join(bin, "frob"), filepath.Join(cwd, "local")} {
+		if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Chdir(cwd)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+".")
+
+	ran := func() []string {
+		data, _ := os.ReadFile(marker)
+		return strings.Fields(string(data))
+	}
+
+	c := NewCompleter(nil, nil)
+
+	if options := c.helpOptions("frob"); len(options) != 0 || len(ran()) != 0 {
+		t.Errorf("without RunHelp, helpOptions(frob) = %v and ran %q, want nothing", options, ran())
+	}
+
+	c.RunHelp = true
+
+	if got := texts(c.helpOptions("frob")); !slices.Equal(got, []string{"-q\tsay nothing", "--quiet\tsay nothing"}) {
+		t.Errorf("with RunHelp, helpOptions(frob) = %q", got)
+	}
+	for _, name := range []string{"local", "./local", filepath.Join(cwd, "local")} {
+		if options := c.helpOptions(name); len(options) != 0 {
+			t.Errorf("helpOptions(%s) = %v, want nothing", name, options)
+		}
+	}
+
+	if got := ran(); !slices.Equal(got, []string{filepath.Join(bin, "frob")}) {
+		t.Errorf("ran %q, want only %s", got, filepath.Join(bin, "frob"))
+	}
+
+}
@@ -0,0 +1,218 @@
+package completer
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"strings"
+
+	"Ebash/internal/parser"
+)
+
+// passwdFile is the user database user names are completed from.
+const passwdFile = "/etc/passwd"
+
+// sshParameterOptions are the options of ssh that take a parameter, and
+// sshFileOptions those whose parameter is a file.
+var (
+	sshParameterOptions = []string{"-B", "-b", "-c", "-D", "-E", "-e", "-F", "-I", "-i", "-J", "-L", "-l", "-m", "-O", "-o", "-P", "-p", "-Q", "-R", "-S", "-W", "-w"}
+	sshFileOptions      = []string{"-E", "-F", "-i", "-S"}
+)
+
+// variablePrefix returns the partial variable reference raw, a word as it
+// was typed, ends with: the part after "$" or "${", and the length of the
+// reference. ok is false if raw does not end with one, including when the
+// dollar sign is escaped or single-quoted.
+func variablePrefix(raw string) (name string, length int, braced, ok bool) {
+
+	dollar := strings.LastIndexByte(raw, '$')
+	if dollar < 0 || parser.OpenQuote(raw[:dollar]) == '\'' || strings.HasSuffix(raw[:dollar], `\`) {
+		return "", 0, false, false
+	}
+
+	name = raw[dollar+1:]
+	if braced = strings.HasPrefix(name, "{"); braced {
+		name = name[1:]
+	}
+
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			return "", 0, false, false
+		}
+	}
+
+	return name, len(raw) - dollar, braced, true
+
+}
+
+// variables completes the partial variable reference ending raw, as found
+// by variablePrefix, with the names of the environment variables, described
+// by their values. The reference is closed with "}" if braced, and followed
+// by a slash when the variable names a directory, or else by a space
+// outside quotes.
+func variables(raw, name string, length int, braced bool) []Item {
+
+	quote := parser.OpenQuote(raw)
+
+	var items []Item
+
+	for _, variable := range matching(variableNames(), name) {
+
+		value := os.Getenv(variable.text)
+
+		suffix := variable.text[len(name):]
+		if braced {
+			suffix += "}"
+		}
+
+		info, err := os.Stat(value)
+		switch {
+		case err == nil && info.IsDir():
+			suffix += "/"
+		case quote == 0:
+			suffix += " "
+		}
+
+		items = append(items, Item{Text: raw + suffix, Display: raw[len(raw)-length:] + variable.text[len(name):], Description: value})
+
+	}
+
+	slices.SortFunc(items, func(a, b Item) int { return strings.Compare(a.Text, b.Text) })
+
+	return items
+
+}
+
+// userNames returns the users of the user database whose name starts with
+// prefix, as "~name" directories described by their full name.
+func userNames(prefix string) []candidate {
+
+	file, err := os.Open(passwdFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var candidates []candidate
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 6 || !strings.HasPrefix(fields[0], prefix) || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		description, _, _ := strings.Cut(fields[4], ",")
+		candidates = append(candidates, candidate{text: "~" + fields[0], description: description, dir: true})
+	}
+
+	return candidates
+
+}
+
+// userHome returns the home directory of the user name, from the user
+// database, or "" if there is no such user.
+func userHome(name string) string {
+
+	file, err := os.Open(passwdFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Split(scanner.Text(), ":"); len(fields) >= 6 && fields[0] == name {
+			return fields[5]
+		}
+	}
+
+	return ""
+
+}
+
+// hostNames returns the host names declared by the Host lines of the ssh
+// configuration of the user, except patterns, then those of /etc/hosts.
+func hostNames() []candidate {
+
+	var candidates []candidate
+	seen := make(map[string]bool)
+
+	add := func(name, description string) {
+		if !seen[name] && !strings.ContainsAny(name, "*?!") {
+			seen[name] = true
+			candidates = append(candidates, candidate{text: name, description: description})
+		}
+	}
+
+	if file, err := os.Open(expandHome("~/.ssh/config")); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(strings.ReplaceAll(scanner.Text(), "=", " "))
+			if len(fields) > 1 && strings.EqualFold(fields[0], "Host") {
+				for _, name := range fields[1:] {
+					add(name, "ssh config")
+				}
+			}
+		}
+	}
+
+	if file, err := os.Open("/etc/hosts"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			if fields := strings.Fields(line); len(fields) > 1 {
+				for _, name := range fields[1:] {
+					add(name, fields[0])
+				}
+			}
+		}
+	}
+
+	return candidates
+
+}
+
+// hostDefinition completes the arguments of ssh and the commands that
+// take a host the same way: host names, after "user@" if given, for the
+// first argument, files for the parameters of the options that name one,
+// and nothing for the remote command. Options are left to the --help
+// output or manual page.
+type hostDefinition struct{}
+
+// complete offers the completions of the word of req, as documented on
+// hostDefinition.
+func (hostDefinition) complete(req request) ([]candidate, bool) {
+
+	if strings.HasPrefix(req.word, "-") {
+		return nil, false
+	}
+
+	if slices.Contains(sshParameterOptions, req.previous) {
+		return nil, slices.Contains(sshFileOptions, req.previous)
+	}
+
+	words := req.words[1 : len(req.words)-1]
+	for i := 0; i < len(words); i++ {
+		switch {
+		case slices.Contains(sshParameterOptions, words[i]):
+			i++
+		case !strings.HasPrefix(words[i], "-"):
+			return nil, false
+		}
+	}
+
+	user := ""
+	if at := strings.LastIndexByte(req.word, '@'); at >= 0 {
+		user = req.word[:at+1]
+	}
+
+	var candidates []candidate
+	for _, host := range hostNames() {
+		candidates = append(candidates, candidate{text: user + host.text, description: host.description})
+	}
+
+	return candidates, false
+
+}
@@ -0,0 +1,117 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unquotedSpecial lists the characters a file name completed outside of
+// quotes has to escape with a backslash.
+const unquotedSpecial = " \t\n\"'\\$`|&;<>()*?[]{}#!"
+
+// pathFilter selects the files offered by paths: dirs restricts them
+// to directories, commands to directories and executable files.
+type pathFilter struct {
+	dirs     bool
+	commands bool
+}
+
+// paths returns the paths of the files that complete prefix. It looks into
+// the directory named by the part of prefix up to its last slash, expanding
+// a leading "~" to the home directory, and offers the entries of that
+// directory starting with the rest of prefix. Hidden entries are only
+// offered when that rest starts with a dot.
+func paths(prefix string, filter pathFilter) []candidate {
+
+	if prefix == "~" {
+		return []candidate{{text: "~", dir: true}}
+	}
+
+	dir, base := "", prefix
+	if slash := strings.LastIndexByte(prefix, '/'); slash >= 0 {
+		dir, base = prefix[:slash+1], prefix[slash+1:]
+	}
+
+	entries, err := readDir(expandHome(dir))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []candidate
+
+	for _, entry := range entries {
+
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		path := filepath.Join(expandHome(dir), name)
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			isDir = err == nil && info.IsDir()
+		}
+
+		if !isDir && (filter.dirs || (filter.commands && !isExecutable(path, entry))) {
+			continue
+		}
+
+		candidates = append(candidates, candidate{text: dir + name, dir: isDir, file: true})
+
+	}
+
+	return candidates
+
+}
+
+// expandHome returns dir with a leading "~" replaced by the home directory
+// and "~name" by the home directory of the user name, or "." when dir is
+// empty.
+func expandHome(dir string) string {
+
+	if dir == "" {
+		return "."
+	}
+
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + dir[1:]
+		}
+	}
+
+	if name, rest, _ := strings.Cut(dir[1:], "/"); strings.HasPrefix(dir, "~") {
+		if home := userHome(name); home != "" {
+			return filepath.Join(home, rest) + "/"
+		}
+	}
+
+	return dir
+
+}
+
+// quoteName quotes text, a part of a file name, for insertion after an
+// open quote (' or "), or escapes it with backslashes when quote is 0.
+func quoteName(text string, quote byte) string {
+
+	var builder strings.Builder
+
+	for _, r := range text {
+		switch {
+		case quote == '\'' && r == '\'':
+			builder.WriteString(`'\''`)
+		case quote == '"' && strings.ContainsRune("\"\\$`", r):
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case quote == 0 && strings.ContainsRune(unquotedSpecial, r):
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+
+}
@@ -0,0 +1,138 @@
+package completer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// process is a running process, as offered for the arguments of kill.
+type process struct {
+	pid     string // process ID
+	name    string // name of its executable, as the kernel reports it
+	user    string // name of its owner, or its user ID if it has no name
+	command string // its command line, or its name in brackets for kernel threads
+	own     bool   // it belongs to the user running the shell
+}
+
+// description describes the process by its owner and command line.
+func (p process) description() string {
+	return fmt.Sprintf("%-8s  %s", p.user, p.command)
+}
+
+// processes returns the running processes whose ID or name starts with
+// word, sorted by ID. Only the processes of the user running the shell are
+// returned, unless none of them matches.
+func processes(word string) []process {
+
+	users := userIDs()
+
+	entries, _ := os.ReadDir("/proc")
+
+	var own, others []process
+
+	for _, entry := range entries {
+
+		pid := entry.Name()
+		if _, err := strconv.Atoi(pid); err != nil || !entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil {
+			continue
+		}
+
+		p := process{pid: pid, name: strings.TrimSpace(string(comm))}
+		if !strings.HasPrefix(p.pid, word) && !strings.HasPrefix(p.name, word) {
+			continue
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid := strconv.Itoa(int(stat.Uid))
+			p.user, p.own = users[uid], int(stat.Uid) == os.Getuid()
+			if p.user == "" {
+				p.user = uid
+			}
+		}
+
+		cmdline, _ := os.ReadFile(filepath.Join("/proc", pid, "cmdline"))
+		p.command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+		if p.command == "" {
+			p.command = "[" + p.name + "]"
+		}
+
+		if p.own {
+			own = append(own, p)
+		} else {
+			others = append(others, p)
+		}
+
+	}
+
+	if len(own) == 0 {
+		own = others
+	}
+
+	slices.SortFunc(own, func(a, b process) int {
+		x, _ := strconv.Atoi(a.pid)
+		y, _ := strconv.Atoi(b.pid)
+		return x - y
+	})
+
+	return own
+
+}
+
+// processIDs returns the IDs of the processes whose ID starts with word as
+// candidates, described by their owner and command line.
+func processIDs(word string) []candidate {
+	var candidates []candidate
+	for _, p := range processes(word) {
+		if strings.HasPrefix(p.pid, word) {
+			candidates = append(candidates, candidate{text: p.pid, description: p.description()})
+		}
+	}
+	return candidates
+}
+
+// userIDs returns the names of the users of the user database, by user ID.
+func userIDs() map[string]string {
+
+	users := make(map[string]string)
+
+	file, err := os.Open(passwdFile)
+	if err != nil {
+		return users
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Split(scanner.Text(), ":"); len(fields) >= 3 {
+			if _, ok := users[fields[2]]; !ok {
+				users[fields[2]] = fields[0]
+			}
+		}
+	}
+
+	return users
+
+}
+
+// processSpec reports whether spec completes with process IDs only, the
+// way kill does by default. Such words are completed with the processes
+// whose ID or name they start, described, and replaced by their ID.
+func processSpec(spec Spec) bool {
+	return slices.Equal(spec.Actions, []string{"process"}) && spec.Words == "" && spec.Function == "" && spec.Command == ""
+}
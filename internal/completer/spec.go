@@ -0,0 +1,175 @@
+package completer
+
+import (
+	"context"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is the completion specification of a command, set by the complete
+// builtin: it tells which words complete the arguments of the command.
+type Spec struct {
+	Actions  []string // kinds of names offered (see Actions), as given to -A
+	Words    string   // word list offered (-W), split on blanks
+	Function string   // command printing the completions (-F)
+	Command  string   // command printing the completions (-C)
+}
+
+// Actions lists the names of the kinds of words a Spec can offer:
+//
+//   - alias: the names of the aliases
+//   - builtin: the names of the builtins
+//   - command: the command names, as completed in command position
+//   - directory: the paths of directories
+//   - file: the paths of files of any kind
+//   - process: the IDs of the processes of the user, or of all processes
+//     when none of those matches
+//   - variable: the names of the environment variables
+var Actions = []string{"alias", "builtin", "command", "directory", "file", "process", "variable"}
+
+// SetSpec makes spec the completion specification of the command name.
+func (c *Completer) SetSpec(name string, spec Spec) {
+	c.specs[name] = spec
+}
+
+// LookupSpec returns the completion specification of the command name.
+func (c *Completer) LookupSpec(name string) (Spec, bool) {
+	spec, ok := c.specs[name]
+	return spec, ok
+}
+
+// RemoveSpec removes the completion specification of the command name and
+// reports whether there was one.
+func (c *Completer) RemoveSpec(name string) bool {
+	_, ok := c.specs[name]
+	delete(c.specs, name)
+	return ok
+}
+
+// ClearSpecs removes every completion specification.
+func (c *Completer) ClearSpecs() {
+	clear(c.specs)
+}
+
+// SpecNames returns the names of the commands that have a completion
+// specification, sorted.
+func (c *Completer) SpecNames() []string {
+	names := make([]string, 0, len(c.specs))
+	for name := range c.specs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Clone returns a copy of c whose specifications, indexes and caches can be
+// changed without changing those of c, for a subshell. The definitions and
+// options cached are shared, since they are replaced but never modified.
+func (c *Completer) Clone() *Completer {
+	return &Completer{
+		commands:    c.commands.clone(),
+		aliases:     c.aliases,
+		builtins:    c.builtins,
+		specs:       maps.Clone(c.specs),
+		definitions: maps.Clone(c.definitions),
+		options:     maps.Clone(c.options),
+		RunHelp:     c.RunHelp,
+	}
+}
+
+// Generate returns the words that complete word according to spec, sorted,
+// the way compgen prints them.
+func (c *Completer) Generate(spec Spec, word string) []string {
+
+	var words []string
+
+	for _, cand := range c.generate(spec, request{word: word, deadline: time.Now().Add(budget)}) {
+		words = append(words, cand.text)
+	}
+
+	return words
+
+}
+
+// generate returns the candidates spec offers to complete the word of req,
+// sorted and without duplicates.
+func (c *Completer) generate(spec Spec, req request) []candidate {
+
+	var candidates []candidate
+
+	for _, action := range spec.Actions {
+		switch action {
+		case "alias":
+			candidates = append(candidates, matching(c.aliases(), req.word)...)
+		case "builtin":
+			candidates = append(candidates, matching(c.builtins(), req.word)...)
+		case "command":
+			candidates = append(candidates, c.commandNames(req.word)...)
+		case "directory":
+			candidates = append(candidates, paths(req.word, pathFilter{dirs: true})...)
+		case "file":
+			candidates = append(candidates, paths(req.word, pathFilter{})...)
+		case "process":
+			candidates = append(candidates, processIDs(req.word)...)
+		case "variable":
+			candidates = append(candidates, matching(variableNames(), req.word)...)
+		}
+	}
+
+	candidates = append(candidates, matching(strings.Fields(spec.Words), req.word)...)
+
+	for _, command := range []string{spec.Function, spec.Command} {
+		if command != "" {
+			candidates = append(candidates, matching(runCommand(command, req), req.word)...)
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return strings.Compare(a.text, b.text)
+	})
+
+	return slices.CompactFunc(candidates, func(a, b candidate) bool {
+		return a.text == b.text
+	})
+
+}
+
+// runCommand runs command, split on blanks, with the name of the command
+// being completed, the word to complete and the word before it as extra
+// arguments, and COMP_LINE and COMP_POINT set to the line up to the cursor
+// and its length, as bash does for complete -C. Every line the command
+// prints is a completion. The command is killed if it has not finished by
+// the deadline of req.
+func runCommand(command string, req request) []string {
+
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), req.deadline)
+	defer cancel()
+
+	cmd := providerCommand(ctx, fields[0], append(fields[1:], req.command, req.word, req.previous)...)
+	cmd.Env = append(os.Environ(), "COMP_LINE="+req.line, "COMP_POINT="+strconv.Itoa(len(req.line)))
+
+	output, _ := cmd.Output()
+
+	return strings.FieldsFunc(string(output), func(r rune) bool { return r == '\n' })
+
+}
+
+// variableNames returns the names of the environment variables.
+func variableNames() []string {
+	var names []string
+	for _, variable := range os.Environ() {
+		if name, _, ok := strings.Cut(variable, "="); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
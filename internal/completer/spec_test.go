@@ -0,0 +1,28 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunCommandReturnsAtDeadline(t *testing.T) {
+
+	script := filepath.Join(t.TempDir(), "slow")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 6\necho late\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	req := requestFor("slow", "")
+	req.deadline = time.Now().Add(200 * time.Millisecond)
+
+	start := time.Now()
+	if got := runCommand(script, req); len(got) != 0 {
+		t.Errorf("runCommand = %q, want nothing", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runCommand returned after %v, want it at the deadline", elapsed)
+	}
+
+}
@@ -0,0 +1,13 @@
+# svc completions, in the style of the files fish ships
+complete -c svc -f
+complete -c svc -n __fish_use_subcommand -a start -d 'Start a service'
+complete -c svc -n __fish_use_subcommand -a 'stop status'
+complete -c svc -n '__fish_seen_subcommand_from start' -s f -l force -d (_ "Start even if running")
+complete -c svc -l config -r -a 'a.conf b.conf' -d 'Configuration file'
+complete -c svc -n 'not __fish_seen_subcommand_from start' -l dry-run -d 'Only show what would be done'
+complete -c svc -a '(__fish_complete_pids) $argv'
+complete -c svc -o old -d 'Old-style option'
+complete -c other -l other-option
+complete -c svc -e -l removed
+complete --command=svc --long-option=verbose \
+    --description='Be verbose'
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -19,13 +20,18 @@ type Config struct {
 }
 
 // Terminal defines settings related to terminal behavior, such as history
-// file, history limit, interrupt and exit prompts, and file descriptor check interval.
+// file, history limit and filtering, interrupt and exit prompts, and file
+// descriptor check interval.
 type Terminal struct {
-	HistoryFile     string `mapstructure:"history_file"`     // Path to shell history file
-	HistoryLimit    int    `mapstructure:"history_limit"`    // Maximum number of history entries
-	InterruptPrompt string `mapstructure:"interrupt_prompt"` // Text shown on Ctrl-C
-	EOFPrompt       string `mapstructure:"exit_message"`     // Text shown on EOF/exit
-	CheckInterval   uint   `mapstructure:"check_interval"`   // Number of pipelines between FD checks
+	HistoryFile          string        `mapstructure:"history_file"`           // Path to shell history file
+	HistoryLimit         int           `mapstructure:"history_limit"`          // Maximum number of history entries
+	HistoryIgnoreSpace   bool          `mapstructure:"history_ignore_space"`   // Do not record lines starting with a blank
+	HistoryIgnoreDups    bool          `mapstructure:"history_ignore_dups"`    // Do not record a line equal to the previous one
+	HistoryEraseDups     bool          `mapstructure:"history_erase_dups"`     // Remove older copies of a line when it is recorded
+	HistoryMergeInterval time.Duration `mapstructure:"history_merge_interval"` // Minimum time between merges of other sessions' entries
+	InterruptPrompt      string        `mapstructure:"interrupt_prompt"`       // Text shown on Ctrl-C
+	EOFPrompt            string        `mapstructure:"exit_message"`           // Text shown on EOF/exit
+	CheckInterval        uint          `mapstructure:"check_interval"`         // Number of pipelines between FD checks
 }
 
 // Prompt defines settings related to the shell prompt appearance,
@@ -38,13 +44,18 @@ type Prompt struct {
 	GitStatusColourBold bool   `mapstructure:"git_status_colour_bold"` // Bold style for git info
 }
 
-// Load reads configuration from a file named "config" in the current
-// directory using Viper, and unmarshals it into a Config instance. Returns
-// a partial Config and an error if loading or unmarshaling fails.
-func Load() (*Config, error) {
-
-	viper.AddConfigPath(".")
-	viper.SetConfigName("config")
+// Load reads configuration using Viper and unmarshals it into a Config
+// instance. The file at path is used when path is not empty; otherwise a
+// file named "config" is looked up in the current directory. Returns a
+// partial Config and an error if loading or unmarshaling fails.
+func Load(path string) (*Config, error) {
+
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.AddConfigPath(".")
+		viper.SetConfigName("config")
+	}
 
 	cfg := new(Config)
 
@@ -67,6 +78,8 @@ func Default() *Config {
 
 	cfg.Terminal.HistoryFile = filepath.Join(os.Getenv("HOME"), ".ebash_history")
 	cfg.Terminal.HistoryLimit = 1000
+	cfg.Terminal.HistoryIgnoreSpace = true
+	cfg.Terminal.HistoryIgnoreDups = true
 	cfg.Terminal.InterruptPrompt = "^C"
 	cfg.Terminal.EOFPrompt = "exit"
 	cfg.Terminal.CheckInterval = 5
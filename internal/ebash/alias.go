@@ -0,0 +1,117 @@
+package ebash
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// alias implements the alias builtin:
+//
+//	alias [-p]               list every alias as a command that defines it
+//	alias name...            print the definitions of the named aliases
+//	alias name=value...      define aliases
+//
+// Definitions and lookups may be mixed; the exit status is 1 if any of the
+// named aliases is not defined.
+func (shell *Shell) alias(command []string, stdout io.Writer) error {
+
+	args := command[1:]
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, name := range shell.aliasNames() {
+			if err := printAlias(stdout, name, shell.env.Aliases[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var failed error
+
+	for _, arg := range args {
+
+		name, value, define := strings.Cut(arg, "=")
+
+		if !define {
+			value, ok := shell.env.Aliases[name]
+			if !ok {
+				failed = fmt.Errorf("ebash: alias: %s: not found", name)
+				continue
+			}
+			if err := printAlias(stdout, name, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !validAliasName(name) {
+			failed = fmt.Errorf("ebash: alias: `%s': invalid alias name", name)
+			continue
+		}
+
+		shell.env.Aliases[name] = value
+
+	}
+
+	return failed
+
+}
+
+// unalias implements "unalias name..." and "unalias -a", which removes every
+// alias. Returns an error naming the last alias that was not defined.
+func (shell *Shell) unalias(command []string) error {
+
+	args := command[1:]
+
+	if len(args) == 0 {
+		return fmt.Errorf("ebash: unalias: usage: unalias [-a] name [name ...]")
+	}
+
+	if args[0] == "-a" {
+		clear(shell.env.Aliases)
+		return nil
+	}
+
+	var failed error
+
+	for _, name := range args {
+		if _, ok := shell.env.Aliases[name]; !ok {
+			failed = fmt.Errorf("ebash: unalias: %s: not found", name)
+			continue
+		}
+		delete(shell.env.Aliases, name)
+	}
+
+	return failed
+
+}
+
+// aliasNames returns the names of the defined aliases in sorted order.
+func (shell *Shell) aliasNames() []string {
+	names := make([]string, 0, len(shell.env.Aliases))
+	for name := range shell.env.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printAlias prints an alias as the alias command that defines it.
+func printAlias(stdout io.Writer, name, value string) error {
+	if _, err := fmt.Fprintf(stdout, "alias %s='%s'\n", name, strings.ReplaceAll(value, "'", `'\''`)); err != nil {
+		return fmt.Errorf("ebash: alias: write operation failed: %w", err)
+	}
+	return nil
+}
+
+// validAliasName reports whether name can be used as an alias: it must not
+// be empty nor contain blanks, quotes, or characters with a special meaning
+// to the parser.
+func validAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n'\"\\`$/=|&<>#")
+}
@@ -0,0 +1,177 @@
+package ebash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"Ebash/internal/builtin"
+)
+
+// statusError is returned by builtins that finish with a specific exit
+// status without having anything to report on stderr.
+type statusError int
+
+// Error implements the error interface.
+func (status statusError) Error() string {
+	return "exit status " + strconv.Itoa(int(status))
+}
+
+// runBuiltin executes a builtin command. Builtins that need access to the
+// shell state (exit, source, return, set, shopt, trap, alias, unalias,
+// history, complete, compgen) are handled here; every other builtin is
+// passed on to builtin.Execute, or to builtin.Subshell in a subshell.
+func (shell *Shell) runBuiltin(command []string, stdin, stdout, stderr *os.File) error {
+
+	switch command[0] {
+	case "exit":
+		return shell.exitShell(command, stderr)
+	case "source", ".":
+		return shell.source(command, stdin, stdout, stderr)
+	case "return":
+		return shell.returnFromSource(command, stderr)
+	case "set":
+		return shell.set(command, stdout, stderr)
+	case "shopt":
+		return shell.shopt(command, stdout)
+	case "trap":
+		return shell.trap(command, stdout)
+	case "alias":
+		return shell.alias(command, stdout)
+	case "unalias":
+		return shell.unalias(command)
+	case "history":
+		return shell.manageHistory(command, stdout)
+	case "complete":
+		return shell.complete(command, stdout)
+	case "compgen":
+		return shell.compgen(command, stdout)
+	}
+
+	if shell.parent != nil {
+		return builtin.Subshell(command, stdin, stdout, stderr)
+	}
+
+	return builtin.Execute(command, stdin, stdout, stderr)
+
+}
+
+// exitShell implements "exit [n]". It marks the shell as exiting with status
+// n, or with the status of the last command when n is omitted. A non-numeric
+// argument still exits, with status 2, while too many arguments keep the
+// shell running.
+func (shell *Shell) exitShell(command []string, stderr io.Writer) error {
+
+	if len(command) > 2 {
+		return fmt.Errorf("ebash: exit: too many arguments")
+	}
+
+	shell.exiting = true
+
+	if len(command) == 1 {
+		return statusError(shell.env.Status)
+	}
+
+	status, err := strconv.Atoi(command[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "ebash: exit: %s: numeric argument required\n", command[1])
+		return statusError(2)
+	}
+
+	return statusError(status & 0xff)
+
+}
+
+// source implements "source file [args]" and ". file [args]". The file is
+// parsed and executed in the current shell, so changes to the working
+// directory and the environment outlive it, and its commands read from
+// stdin and write to stdout and stderr, those of source itself, unless they
+// redirect them. A name without a slash is looked up in $PATH first and in
+// the current directory second. When arguments are given they replace the
+// positional parameters while the file runs. The exit status is the one of
+// the last command executed, or the one passed to return.
+func (shell *Shell) source(command []string, stdin, stdout, stderr *os.File) error {
+
+	if len(command) < 2 {
+		return fmt.Errorf("ebash: %s: filename argument required", command[0])
+	}
+
+	data, err := os.ReadFile(lookupSource(command[1]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("ebash: %s: No such file or directory", command[1])
+		}
+		return fmt.Errorf("ebash: %s: %w", command[1], err)
+	}
+
+	if len(command) > 2 {
+		args := shell.env.Args
+		shell.env.Args = append([]string{shell.env.Args[0]}, command[2:]...)
+		defer func() { shell.env.Args = args }()
+	}
+
+	streams := []*os.File{shell.stdin, shell.stdout, shell.stderr}
+	shell.stdin, shell.stdout, shell.stderr = stdin, stdout, stderr
+	defer func() { shell.stdin, shell.stdout, shell.stderr = streams[0], streams[1], streams[2] }()
+
+	shell.depth++
+	shell.runLines(bytes.NewReader(data))
+	shell.depth--
+	shell.returning = false
+
+	shell.runTrap("RETURN")
+
+	return statusError(shell.env.Status)
+
+}
+
+// lookupSource resolves the file name given to source. Names containing a
+// slash are used as they are; bare names are searched for in $PATH and
+// fall back to the current directory.
+func lookupSource(name string) string {
+
+	if strings.Contains(name, "/") {
+		return name
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+
+	return name
+
+}
+
+// returnFromSource implements "return [n]". It stops the file being sourced
+// with status n, or with the status of the last command when n is omitted.
+// Outside of a sourced file it is an error.
+func (shell *Shell) returnFromSource(command []string, stderr io.Writer) error {
+
+	if shell.depth == 0 {
+		return fmt.Errorf("ebash: return: can only `return' from a function or sourced script")
+	} else if len(command) > 2 {
+		return fmt.Errorf("ebash: return: too many arguments")
+	}
+
+	shell.returning = true
+
+	if len(command) == 1 {
+		return statusError(shell.env.Status)
+	}
+
+	status, err := strconv.Atoi(command[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "ebash: return: %s: numeric argument required\n", command[1])
+		return statusError(2)
+	}
+
+	return statusError(status & 0xff)
+
+}
@@ -0,0 +1,248 @@
+package ebash
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"Ebash/internal/completer"
+)
+
+// completeUsage and compgenUsage are printed after the errors of the
+// complete and compgen builtins.
+const (
+	completeUsage = "complete: usage: complete [-pr] [-abcdfv] [-A action] [-W wordlist] [-F function] [-C command] [name ...]"
+	compgenUsage  = "compgen: usage: compgen [-abcdfv] [-A action] [-W wordlist] [-F function] [-C command] [word]"
+)
+
+// actionFlags maps the single-letter options of complete and compgen to the
+// actions they stand for.
+var actionFlags = map[byte]string{
+	'a': "alias",
+	'b': "builtin",
+	'c': "command",
+	'd': "directory",
+	'f': "file",
+	'v': "variable",
+}
+
+// complete implements the complete builtin, which sets how the arguments
+// of commands are completed:
+//
+//	complete [-p] [name...]        print completion specifications as complete commands
+//	complete -r [name...]          remove them (every one without names)
+//	complete [options] name...     set the specification of the named commands
+//
+// The options say which words complete an argument: -f files, -d
+// directories, -c command names, -v variable names, -a aliases, -b
+// builtins, -A action any of those by name (or process for process IDs),
+// -W the words of wordlist. ebash has no shell functions, so -F, like -C,
+// names a program printing one completion per line; it is given the
+// command name, the word to complete and the word before it as arguments.
+func (shell *Shell) complete(command []string, stdout io.Writer) error {
+
+	spec, args, flags, err := parseSpec("complete", command[1:])
+	if err != nil {
+		return err
+	}
+
+	if flags.remove {
+		if len(args) == 0 {
+			shell.completer.ClearSpecs()
+			return nil
+		}
+		var failed error
+		for _, name := range args {
+			if !shell.completer.RemoveSpec(name) {
+				failed = fmt.Errorf("ebash: complete: %s: no completion specification", name)
+			}
+		}
+		return failed
+	}
+
+	if flags.print || !flags.set {
+		if len(args) == 0 {
+			args = shell.completer.SpecNames()
+		}
+		var failed error
+		for _, name := range args {
+			spec, ok := shell.completer.LookupSpec(name)
+			if !ok {
+				failed = fmt.Errorf("ebash: complete: %s: no completion specification", name)
+				continue
+			}
+			if _, err := fmt.Fprintln(stdout, formatSpec(name, spec)); err != nil {
+				return fmt.Errorf("ebash: complete: write operation failed: %w", err)
+			}
+		}
+		return failed
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("ebash: complete: no command names given\n%s", completeUsage)
+	}
+
+	for _, name := range args {
+		shell.completer.SetSpec(name, spec)
+	}
+
+	return nil
+
+}
+
+// compgen implements "compgen [options] [word]", which prints the words
+// that the options of complete would offer to complete word, one per line.
+// The exit status is 1 when there are none.
+func (shell *Shell) compgen(command []string, stdout io.Writer) error {
+
+	spec, args, _, err := parseSpec("compgen", command[1:])
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("ebash: compgen: too many arguments\n%s", compgenUsage)
+	}
+
+	var word string
+	if len(args) == 1 {
+		word = args[0]
+	}
+
+	words := shell.completer.Generate(spec, word)
+	if len(words) == 0 {
+		return statusError(1)
+	}
+
+	if _, err := fmt.Fprintln(stdout, strings.Join(words, "\n")); err != nil {
+		return fmt.Errorf("ebash: compgen: write operation failed: %w", err)
+	}
+
+	return nil
+
+}
+
+// specFlags are the options of complete that are not part of a
+// specification.
+type specFlags struct {
+	print  bool // -p: print specifications
+	remove bool // -r: remove specifications
+	set    bool // an option of the specification itself was given
+}
+
+// parseSpec parses the options of the complete or compgen builtin (named
+// by builtin) in args into a specification, and returns it with the
+// remaining arguments. -p and -r are only accepted by complete.
+func parseSpec(builtin string, args []string) (completer.Spec, []string, specFlags, error) {
+
+	var spec completer.Spec
+	var flags specFlags
+
+	usage := completeUsage
+	if builtin == "compgen" {
+		usage = compgenUsage
+	}
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+
+		arg := args[0]
+		args = args[1:]
+
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+
+			flag := arg[i]
+
+			if action, ok := actionFlags[flag]; ok {
+				spec.Actions = append(spec.Actions, action)
+				flags.set = true
+				continue
+			}
+
+			switch {
+			case (flag == 'p' || flag == 'r') && builtin == "complete":
+				flags.print = flags.print || flag == 'p'
+				flags.remove = flags.remove || flag == 'r'
+				continue
+			case flag != 'A' && flag != 'W' && flag != 'F' && flag != 'C':
+				return spec, nil, flags, fmt.Errorf("ebash: %s: -%c: invalid option\n%s", builtin, flag, usage)
+			}
+
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return spec, nil, flags, fmt.Errorf("ebash: %s: -%c: option requires an argument\n%s", builtin, flag, usage)
+				}
+				value, args = args[0], args[1:]
+			}
+
+			switch flag {
+			case 'A':
+				if !slices.Contains(completer.Actions, value) {
+					return spec, nil, flags, fmt.Errorf("ebash: %s: %s: invalid action name", builtin, value)
+				}
+				spec.Actions = append(spec.Actions, value)
+			case 'W':
+				spec.Words = value
+			case 'F':
+				spec.Function = value
+			case 'C':
+				spec.Command = value
+			}
+
+			flags.set = true
+			break
+
+		}
+
+	}
+
+	return spec, args, flags, nil
+
+}
+
+// formatSpec returns the complete command that sets spec as the completion
+// specification of the command name.
+func formatSpec(name string, spec completer.Spec) string {
+
+	parts := []string{"complete"}
+
+	for _, action := range spec.Actions {
+		flag := ""
+		for letter, flagAction := range actionFlags {
+			if flagAction == action {
+				flag = "-" + string(letter)
+			}
+		}
+		if flag == "" {
+			flag = "-A " + action
+		}
+		parts = append(parts, flag)
+	}
+
+	if spec.Words != "" {
+		parts = append(parts, "-W "+quoteWord(spec.Words))
+	}
+	if spec.Function != "" {
+		parts = append(parts, "-F "+quoteWord(spec.Function))
+	}
+	if spec.Command != "" {
+		parts = append(parts, "-C "+quoteWord(spec.Command))
+	}
+
+	return strings.Join(append(parts, name), " ")
+
+}
+
+// quoteWord quotes s with single quotes if it contains characters special
+// to the shell.
+func quoteWord(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\`$|&;<>()*?[]{}#~!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,71 +1,167 @@
-// Package ebash contains the core interactive shell loop and orchestration
-// logic for the ebash project. It wires together configuration, the
-// readline-based terminal, builtin command execution, external command
-// execution, and signal handling.
+// Package ebash contains the core shell loop and orchestration logic for the
+// ebash project. It wires together configuration, the readline-based
+// terminal, builtin command execution, external command execution, and
+// signal handling, and runs scripts and command strings non-interactively.
 package ebash
 
 import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"os/signal"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/chzyer/readline"
 
-	"Ebash/internal/builtin"
 	"Ebash/internal/completer"
 	"Ebash/internal/config"
+	"Ebash/internal/editor"
 	"Ebash/internal/external"
+	"Ebash/internal/history"
 	"Ebash/internal/painter"
 	"Ebash/internal/parser"
 
 	"Ebash/internal/prompt"
+
+	"golang.org/x/term"
 )
 
-// Shell holds the runtime state of the interactive ebash shell. It manages
+// Shell holds the runtime state of the ebash shell. It manages
 // synchronization, signal handling, terminal interaction, and command
 // execution. It also tracks running external processes and performs periodic
 // file descriptor checks to detect leaks.
 type Shell struct {
 	mu            sync.Mutex           // protects mutable fields (e.g. externals)
-	sigCh         chan os.Signal       // receives OS signals (e.g. os.Interrupt)
+	sigCh         chan os.Signal       // receives OS signals caught by the shell (e.g. os.Interrupt)
 	stopCh        chan struct{}        // closed to request shutdown of background goroutines
 	painter       painter.Painter      // renders the shell prompt with colors and styles
-	pipeline      []parser.Pipe        // parsed pipeline: sequence of conditional Pipe sections
-	terminal      *readline.Instance   // readline instance used to read user input
+	env           parser.Env           // state consulted when expanding pipes (e.g. last exit status)
+	exiting       bool                 // set by the exit builtin; stops the current line and the shell
+	returning     bool                 // set by the return builtin; stops the file being sourced
+	depth         int                  // nesting level of files being sourced; 0 at the top level
+	traps         map[string]string    // trap handlers by signal name ("INT", "EXIT", ...); "" ignores the signal
+	pending       []string             // names of trapped signals received since the last safe point
+	hangup        bool                 // set when an untrapped SIGHUP arrives; the shell exits at the next safe point
+	inTrap        bool                 // true while a trap handler runs, so that handlers do not trigger traps
+	interactive   bool                 // true when commands are read from the terminal
+	options       []option             // options managed by set (errexit, xtrace, ...), sorted by name
+	shopts        []option             // extended options managed by shopt (dotglob, nullglob, ...)
+	errexit       bool                 // exit as soon as a pipe outside of a &&/|| list fails (set -e)
+	pipefail      bool                 // a pipe fails with the last failing command, not the last command (set -o pipefail)
+	xtrace        bool                 // print every expanded command to stderr before running it (set -x)
+	verbose       bool                 // print every input line to stderr as it is read (set -v)
+	histexpand    bool                 // perform "!" history expansion on interactive input (set -H)
+	dumpAST       bool                 // print parsed pipelines instead of executing them (--dump-ast)
+	terminal      *readline.Instance   // readline instance used to read user input; nil when non-interactive
 	builtins      map[string]struct{}  // set of builtin command names for quick lookup
 	completer     *completer.Completer // provides dynamic, context-aware tab completion for commands
-	externals     []*exec.Cmd          // running external commands tracked for signaling/waiting
+	editor        *editor.Editor       // paints the line being edited and provides the fuzzy history search
+	history       *history.History     // command lines entered at the prompt, with their outcome
+	mergeInterval time.Duration        // minimum time between merges of the history written by other shells
+	lastMerge     time.Time            // when the history was last merged
+	externals     []*exec.Cmd          // running external commands tracked for signal forwarding
 	descriptors   int                  // baseline number of file descriptors at shell startup
 	checkCounter  uint                 // incremented each pipeline; fd check runs only when reaching checkInterval
 	checkInterval uint                 // number of pipelines between descriptor checks; set to 0 in config to disable
+	parent        *Shell               // shell a subshell was copied from; nil for the shell itself
+	stdin         *os.File             // standard input of the commands run, unless redirected; changed by source
+	stdout        *os.File             // standard output of the commands run, unless redirected; changed by source
+	stderr        *os.File             // standard error of the commands run; changed by source
+}
+
+// Options describe how the shell was started. They are filled in by the
+// command-line front-end in cmd/ebash.
+type Options struct {
+	Command     string   // command string passed with -c; empty when not given
+	Script      string   // path of the script file to execute; empty when not given
+	Args        []string // positional parameters; Args[0] is expanded by "$0"
+	ConfigPath  string   // config file to load instead of ./config.yaml (--config)
+	NoRC        bool     // skip the interactive startup files (--norc)
+	NoProfile   bool     // skip the login profile (--noprofile)
+	Interactive bool     // force an interactive shell even if stdin is not a terminal (-i)
+	Login       bool     // act as a login shell (-l)
+	XTrace      bool     // print commands before executing them (-x)
+	ErrExit     bool     // exit as soon as a pipe fails (-e)
+	DumpAST     bool     // print parsed pipelines instead of executing them (--dump-ast)
 }
 
-// Run starts the main interactive loop of the shell. It boots the shell,
-// then repeatedly reads lines from the terminal, parses them into pipelines,
-// executes those pipelines and reports any errors. The function returns only
-// when EOF is received or the user executes the "exit" command.
-func Run() {
+// Run starts the shell described by opts and returns its exit status. With
+// a command string or a script file the shell runs non-interactively; with
+// neither it reads commands from stdin, interactively when stdin is a
+// terminal (or -i was given) and line by line (like a script) otherwise.
+func Run(opts Options) int {
 
-	shell, err := boot()
+	interactive := opts.Command == "" && opts.Script == "" && (opts.Interactive || term.IsTerminal(int(os.Stdin.Fd())))
+
+	shell, err := boot(interactive, opts.ConfigPath)
 	if err != nil {
 		panic(err)
 	}
 
+	shell.xtrace = opts.XTrace
+	shell.errexit = opts.ErrExit
+	shell.dumpAST = opts.DumpAST
+
 	defer shell.exit()
 
+	shell.env.Args = opts.Args
+	if len(shell.env.Args) == 0 {
+		shell.env.Args = []string{"ebash"}
+	}
+
+	shell.loadStartupFiles(opts, interactive)
+
+	switch {
+	case shell.exiting:
+		// a startup file has already run exit
+	case opts.Command != "":
+		shell.runLines(strings.NewReader(opts.Command))
+	case opts.Script != "":
+		shell.runScript(opts.Script)
+	case interactive:
+		shell.runInteractive()
+	default:
+		shell.runLines(os.Stdin)
+	}
+
+	shell.runTraps()
+	shell.runExitTrap()
+
+	return shell.env.Status
+
+}
+
+// runInteractive is the main interactive loop of the shell. It repeatedly
+// reads lines from the terminal, expands history references and records the
+// lines in the history, parses them into pipelines, executes those pipelines
+// and reports any errors. Pending traps run before every prompt, as does the
+// merge of the history lines other shells saved in the meantime, and Ctrl-C
+// at the prompt runs the INT trap. The function returns only when EOF is
+// received, the user executes the "exit" command or a SIGHUP arrives.
+func (shell *Shell) runInteractive() {
+
 	for {
 
-		shell.completer.Update()
-		shell.terminal.SetPrompt(prompt.Update(shell.painter))
+		shell.runTraps()
+		if shell.exiting {
+			return
+		}
+
+		shell.mergeHistory()
+		shell.editor.SetPrompt(prompt.Update(shell.painter))
 
 		line, err := shell.terminal.Readline()
 		if err != nil {
 			if errors.Is(err, readline.ErrInterrupt) {
+				shell.runTrap("INT")
 				continue
 			} else if errors.Is(err, io.EOF) {
 				return
@@ -73,216 +169,469 @@ func Run() {
 			panic(err)
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
+		line, run := shell.expandHistory(line)
+		if !run {
 			continue
-		} else if line == "exit" {
-			fmt.Println(shell.terminal.Config.EOFPrompt[1:])
-			return
 		}
 
-		shell.pipeline, err = parser.Parse(line)
-		if err != nil {
-			shell.sysmon(err)
-			continue
-		}
+		start := time.Now()
+		shell.execute(line)
+		shell.finishHistory(time.Since(start))
 
-		shell.sysmon(shell.runPipeline())
+		if shell.exiting {
+			fmt.Println(shell.terminal.Config.EOFPrompt[1:])
+			return
+		}
 
 	}
 
 }
 
-// boot initializes the shell runtime. It loads configuration (falling back
-// to defaults if needed), sets up the readline terminal, initializes the
-// prompt painter and completer, and starts the interrupt handler.
-// Returns the initialized Shell instance or an error.
-func boot() (*Shell, error) {
+// execute parses a single command line and runs the resulting pipeline,
+// reporting errors and leaks through sysmon. Empty lines are ignored. Under
+// set -v the line is echoed to stderr before anything else happens.
+// The exit status is left in the shell environment for "$?".
+func (shell *Shell) execute(line string) {
 
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "ebash: boot: failed to load config: %v; falling back to default values\n", err)
-		cfg = config.Default()
+	if shell.verbose {
+		fmt.Fprintln(shell.stderr, line)
 	}
 
-	readlineCfg := &readline.Config{
-		HistoryFile:     cfg.Terminal.HistoryFile,
-		HistoryLimit:    cfg.Terminal.HistoryLimit,
-		InterruptPrompt: cfg.Terminal.InterruptPrompt,
-		EOFPrompt:       "\n" + cfg.Terminal.EOFPrompt,
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
 	}
 
-	terminal, err := readline.NewEx(readlineCfg)
+	pipeline, err := parser.Parse(line, &shell.env)
 	if err != nil {
-		return nil, fmt.Errorf("ebash: boot: fatal: failed to create new terminal instance: %w", err)
+		shell.env.Status = 2
+		shell.sysmon(err)
+		return
 	}
 
-	var descriptors int
-	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", os.Getpid()))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "ebash: boot: failed to read fd directory: %v; falling back to default descriptor count of 10\n", err)
-		descriptors = 10
-	} else {
-		descriptors = len(entries)
+	if shell.dumpAST {
+		dumpAST(shell.stdout, pipeline, shell.env)
+		return
+	}
+
+	shell.sysmon(shell.runPipeline(pipeline))
+
+}
+
+// isCommand reports whether name can be run as a command: whether it is a
+// builtin, an alias or an executable file, looked up in $PATH unless name
+// contains a slash.
+func (shell *Shell) isCommand(name string) bool {
+
+	if _, ok := shell.builtins[name]; ok {
+		return true
+	}
+
+	if _, ok := shell.env.Aliases[name]; ok {
+		return true
 	}
 
+	_, err := exec.LookPath(name)
+
+	return err == nil
+
+}
+
+// builtinNames returns the names of the builtins in sorted order.
+func (shell *Shell) builtinNames() []string {
+	names := make([]string, 0, len(shell.builtins))
+	for name := range shell.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// boot initializes the shell runtime. It loads the configuration (falling
+// back to defaults if needed) for an interactive shell, or for any shell
+// when configPath names the config file explicitly; a non-interactive
+// shell started without it uses the default configuration. For an
+// interactive shell it then sets up the readline terminal, initializes the
+// prompt painter, attaches the editor, which completes through the
+// completer, and starts the interrupt handler. Returns the initialized
+// Shell instance or an error.
+func boot(interactive bool, configPath string) (*Shell, error) {
+
+	cfg := config.Default()
+
 	shell := &Shell{
-		terminal:      terminal,
-		sigCh:         make(chan os.Signal, 1),
-		stopCh:        make(chan struct{}),
-		descriptors:   descriptors,
-		checkInterval: cfg.Terminal.CheckInterval,
-		painter:       painter.NewPainter(cfg.Prompt),
-		completer:     completer.NewCompleter(),
+		interactive: interactive,
+		stdin:       os.Stdin,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		sigCh:       make(chan os.Signal, 1),
+		stopCh:      make(chan struct{}),
+		traps:       make(map[string]string),
+		history:     history.New("", 0, history.Control{}),
+		env: parser.Env{
+			Aliases:       make(map[string]string),
+			ExpandAliases: interactive,
+		},
 		builtins: map[string]struct{}{
-			"cd":   {},
-			"cd..": {},
-			"pwd":  {},
-			"echo": {},
-			"kill": {},
-			"ps":   {},
+			"cd":       {},
+			"cd..":     {},
+			"pwd":      {},
+			"echo":     {},
+			"kill":     {},
+			"ps":       {},
+			"exit":     {},
+			"export":   {},
+			"source":   {},
+			".":        {},
+			"return":   {},
+			"set":      {},
+			"shopt":    {},
+			"trap":     {},
+			"alias":    {},
+			"unalias":  {},
+			"history":  {},
+			"complete": {},
+			"compgen":  {},
 		},
 	}
 
-	shell.terminal.Config.AutoComplete = shell.completer
+	shell.completer = completer.NewCompleter(shell.aliasNames, shell.builtinNames)
+
+	shell.registerOptions()
+
+	if interactive || configPath != "" {
+		loaded, err := config.Load(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ebash: boot: failed to load config: %v; falling back to default values\n", err)
+		} else {
+			cfg = loaded
+		}
+	}
+
+	if interactive {
+
+		readlineCfg := &readline.Config{
+			HistoryLimit:           cfg.Terminal.HistoryLimit,
+			DisableAutoSaveHistory: true,
+			InterruptPrompt:        cfg.Terminal.InterruptPrompt,
+			EOFPrompt:              "\n" + cfg.Terminal.EOFPrompt,
+		}
+
+		terminal, err := readline.NewEx(readlineCfg)
+		if err != nil {
+			return nil, fmt.Errorf("ebash: boot: fatal: failed to create new terminal instance: %w", err)
+		}
+		shell.terminal = terminal
+
+		shell.history = history.New(cfg.Terminal.HistoryFile, cfg.Terminal.HistoryLimit, history.Control{
+			IgnoreSpace: cfg.Terminal.HistoryIgnoreSpace,
+			IgnoreDups:  cfg.Terminal.HistoryIgnoreDups,
+			EraseDups:   cfg.Terminal.HistoryEraseDups,
+		})
+		shell.mergeInterval = cfg.Terminal.HistoryMergeInterval
+		shell.lastMerge = time.Now()
+		if err := shell.history.Read(""); err != nil {
+			fmt.Fprintf(os.Stderr, "ebash: boot: failed to load history: %v\n", err)
+		}
+		shell.syncTerminalHistory(0)
+		shell.histexpand = true
+
+		shell.painter = painter.NewPainter(cfg.Prompt)
+
+		shell.editor = editor.New(shell.painter, func() []*history.Entry {
+			entries, _ := shell.history.Entries()
+			return entries
+		}, shell.isCommand, shell.completer.Complete)
+		shell.editor.Attach(shell.terminal)
+
+		signal.Notify(shell.sigCh, interactiveSignals...)
+
+	}
+
+	go shell.signalHandler()
 
-	signal.Notify(shell.sigCh, os.Interrupt)
-	go shell.interruptHandler()
+	shell.checkInterval = cfg.Terminal.CheckInterval
+
+	// The first file opened starts the poller of the Go runtime, whose
+	// descriptors stay open for good; a non-interactive shell has not opened
+	// one yet, so start the poller now for them to count in the baseline.
+	if reader, writer, err := os.Pipe(); err == nil {
+		closeDescriptors(reader, writer)
+	}
+
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", os.Getpid()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ebash: boot: failed to read fd directory: %v; falling back to default descriptor count of 10\n", err)
+		shell.descriptors = 10
+	} else {
+		shell.descriptors = len(entries)
+	}
 
 	return shell, nil
 
 }
 
-// interruptHandler listens for OS interrupt signals (SIGINT) and forwards
-// them as Interrupt signals to any running external commands. The goroutine
-// exits when the shell stop channel is closed.
-func (shell *Shell) interruptHandler() {
+// signalHandler listens for the OS signals caught by the shell. SIGINT is
+// forwarded to any running external commands; an untrapped SIGHUP is
+// forwarded to them as well and makes the shell exit, closing the terminal
+// so that a pending read returns; untrapped SIGTERM and SIGQUIT are dropped.
+// Trapped signals are queued for runTraps. The goroutine exits when the
+// shell stop channel is closed.
+func (shell *Shell) signalHandler() {
 	for {
 		select {
 		case <-shell.stopCh:
 			return
-		case <-shell.sigCh:
+		case sig := <-shell.sigCh:
 			shell.mu.Lock()
-			for _, externalCommand := range shell.externals {
-				_ = externalCommand.Process.Signal(os.Interrupt) // https://www.youtube.com/watch?v=g3m369iaOlI
+			name := signalName(sig)
+			_, trapped := shell.traps[name]
+			switch {
+			case sig == os.Interrupt:
+				shell.forward(os.Interrupt) // https://www.youtube.com/watch?v=g3m369iaOlI
+			case sig == syscall.SIGHUP && !trapped:
+				shell.forward(syscall.SIGHUP)
+				shell.hangup = true
+				if shell.terminal != nil {
+					_ = shell.terminal.Close()
+				}
+			}
+			if trapped {
+				shell.pending = append(shell.pending, name)
 			}
 			shell.mu.Unlock()
 		}
 	}
 }
 
+// forward sends sig to every running external command. The caller must
+// hold the mutex.
+func (shell *Shell) forward(sig os.Signal) {
+	for _, externalCommand := range shell.externals {
+		_ = externalCommand.Process.Signal(sig)
+	}
+}
+
 // exit performs cleanup of the shell runtime: it stops signal delivery,
-// signals the interrupt handler to stop, and closes the readline terminal.
+// signals the signal handler to stop, sends SIGHUP to commands that are
+// still running, and closes the readline terminal if the shell is
+// interactive.
 func (shell *Shell) exit() {
 	signal.Stop(shell.sigCh)
 	close(shell.stopCh)
-	_ = shell.terminal.Close()
+	shell.mu.Lock()
+	shell.forward(syscall.SIGHUP)
+	shell.mu.Unlock()
+	if shell.terminal != nil {
+		_ = shell.terminal.Close()
+	}
 }
 
 // runPipeline executes the parsed pipeline (which may contain multiple pipe
 // segments). It honors conditional execution flags (NextAnd/NextOr) between
-// pipeline segments and returns the first error encountered, if any.
-func (shell *Shell) runPipeline() error {
-
-	var shouldRun bool
-	var lastExitCode int
-
-	for i := 0; i < len(shell.pipeline); i++ {
+// pipeline segments based on the exit status of the last executed segment,
+// builds each segment right before running it and records its exit status
+// for "$?". A segment that cannot be built (a failed redirection or a
+// failglob miss) is reported and fails with status 1, like one that ran.
+// Execution stops early once the "exit" or "return" builtin has run, when
+// errexit is set and a segment that is not part of a &&/|| list fails, or
+// when a non-interactive shell expands an unset variable under set -u.
+// Under set -x every command is traced before it runs. The DEBUG trap runs
+// before every segment, the ERR trap after a failing segment that is not part
+// of a &&/|| list, and pending signal traps after every segment. It returns
+// the first error encountered while setting up a segment, if any.
+func (shell *Shell) runPipeline(pipeline []parser.Pipe) error {
+
+	for i := range pipeline {
+
+		if shell.exiting || shell.returning {
+			return nil
+		}
 
-		pipe := shell.pipeline[i]
-		shouldRun = true
+		pipe := &pipeline[i]
 
 		if i > 0 {
 
-			previousPipe := shell.pipeline[i-1]
+			previousPipe := pipeline[i-1]
 
-			if previousPipe.NextAnd && lastExitCode != 0 {
-				shouldRun = false
-			} else if previousPipe.NextOr && lastExitCode == 0 {
-				shouldRun = false
+			if previousPipe.NextAnd && shell.env.Status != 0 {
+				continue
+			} else if previousPipe.NextOr && shell.env.Status == 0 {
+				continue
 			}
 
 		}
 
-		if shouldRun {
-			exitCode, err := shell.runPipe(pipe)
-			lastExitCode = exitCode
+		shell.runTrap("DEBUG")
+
+		exitCode := 1
+
+		if err := pipe.Build(&shell.env); err != nil {
+			fmt.Fprintln(shell.stderr, err)
+			if errors.Is(err, parser.ErrUnbound) && !shell.interactive {
+				shell.exiting = true
+			}
+			shell.env.Status = exitCode
+		} else {
+
+			if shell.xtrace {
+				for _, command := range pipe.Section {
+					trace(shell.stderr, command)
+				}
+			}
+
+			exitCode, err = shell.runPipe(*pipe)
+			shell.env.Status = exitCode
 			if err != nil {
 				return err
 			}
+
+		}
+
+		if exitCode != 0 && !pipe.NextAnd && !pipe.NextOr {
+			shell.runTrap("ERR")
+			if shell.errexit {
+				shell.exiting = true
+			}
 		}
 
+		shell.runTraps()
+
 	}
 
 	return nil
 
 }
 
+// stage is a single running command of a pipe section. External commands
+// are tracked through their *exec.Cmd, builtins run in their own goroutine
+// and report their exit code through done.
+type stage struct {
+	cmd  *exec.Cmd // started external command, nil for builtins
+	done chan int  // receives the exit code of a builtin, nil for externals
+}
+
 // runPipe executes a single pipe segment composed of multiple commands
-// connected by pipes. Builtin commands are executed synchronously via the
-// builtin package; external commands are spawned and tracked. The function
-// wires up pipes between commands, handles input/output redirection, waits
-// for external processes to finish, and returns the exit code and an error
-// if any operation fails.
+// connected by pipes. Every command is started before any of them is waited
+// on: external commands are spawned and tracked, builtins run concurrently
+// in goroutines with the same stdin/stdout wiring, so a builtin can both feed
+// and consume a pipe without deadlocking. As in bash, every stage of a pipe
+// of several commands runs in a subshell: a builtin there runs against a
+// copy of the shell, so whatever it changes does not outlive it. A command
+// that cannot be started is reported like bash does and takes part in the
+// pipe with status 127 or 126. The function handles input/output
+// redirection, waits for all stages to finish, and returns the exit code of
+// the last command and an error if setting up the pipeline fails.
 func (shell *Shell) runPipe(pipe parser.Pipe) (int, error) {
 
-	var err error
-	var lastInSection bool
-	var writer, connector, reader *os.File
+	var stages []stage
+	var connector *os.File
 
 	for i, command := range pipe.Section {
 
-		lastInSection = (i == len(pipe.Section)-1)
+		var err error
+		var reader, writer *os.File
 
-		if !lastInSection {
+		if i < len(pipe.Section)-1 {
 			reader, writer, err = os.Pipe()
 			if err != nil {
-				closeDescriptors(writer, connector, reader)
+				closeDescriptors(connector)
+				shell.wait(stages)
+				closeDescriptors(pipe.Input, pipe.Output)
 				return 1, err
 			}
 		}
 
+		stdin, stdout := shell.streams(connector, writer, pipe)
+
 		if _, builtinCommand := shell.builtins[command[0]]; builtinCommand {
-			err = builtin.Execute(command, writer, pipe.Output, lastInSection)
+			runner := shell
+			if len(pipe.Section) > 1 {
+				runner = shell.subshell()
+			}
+			stages = append(stages, runner.startBuiltin(command, stdin, stdout, connector, writer))
 		} else {
-			execCmd, externalError := external.Execute(command, writer, connector, pipe.Input, pipe.Output, lastInSection)
-			if externalError == nil {
-				shell.mu.Lock()
-				shell.externals = append(shell.externals, execCmd)
-				shell.mu.Unlock()
+			execCmd, externalError := external.Execute(command, stdin, stdout, shell.stderr)
+			closeDescriptors(writer, connector)
+			if externalError != nil {
+				message, exitCode := external.Failure(command[0], externalError)
+				fmt.Fprintln(shell.stderr, message)
+				stages = append(stages, finished(exitCode))
 			} else {
-				err = externalError
+				shell.track(execCmd)
+				stages = append(stages, stage{cmd: execCmd})
 			}
-
 		}
 
-		if err != nil {
-			closeDescriptors(writer, connector, reader, pipe.Input, pipe.Output)
-			return 1, err
-		}
+		connector = reader
 
-		closeDescriptors(writer, connector)
+	}
 
-		if !lastInSection {
-			connector = reader
-		}
+	exitCode := shell.wait(stages)
+	closeDescriptors(pipe.Input, pipe.Output)
+
+	return exitCode, nil
+
+}
+
+// streams resolves the standard input and output of a command within a pipe
+// section. Input comes from the previous command (connector), the input
+// redirection file or the shell's stdin; output goes to the next command
+// (writer), the output redirection file or the shell's stdout. Within a
+// sourced file, the shell's stdin and stdout are those of source.
+func (shell *Shell) streams(connector, writer *os.File, pipe parser.Pipe) (*os.File, *os.File) {
+
+	stdin, stdout := shell.stdin, shell.stdout
 
+	if connector != nil {
+		stdin = connector
+	} else if pipe.Input != nil {
+		stdin = pipe.Input
 	}
 
-	closeDescriptors(reader, pipe.Input, pipe.Output)
+	if writer != nil {
+		stdout = writer
+	} else if pipe.Output != nil {
+		stdout = pipe.Output
+	}
 
-	if shell.externals != nil {
-		err = shell.sync()
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				return exitErr.ExitCode(), nil
-			}
-			return 1, err
+	return stdin, stdout
+
+}
+
+// startBuiltin runs a builtin command in its own goroutine and returns the
+// stage that reports its exit code. The goroutine owns the pipe ends it was
+// given (connector and writer) and closes them once the builtin returns, so
+// the neighbouring commands observe EOF exactly as with an exited process.
+func (shell *Shell) startBuiltin(command []string, stdin, stdout, connector, writer *os.File) stage {
+
+	done := make(chan int, 1)
+
+	go func() {
+		var status statusError
+		exitCode := 0
+		if err := shell.runBuiltin(command, stdin, stdout, shell.stderr); errors.As(err, &status) {
+			exitCode = int(status)
+		} else if errors.Is(err, syscall.EPIPE) {
+			exitCode = 128 + int(syscall.SIGPIPE)
+		} else if err != nil {
+			fmt.Fprintln(shell.stderr, err)
+			exitCode = 1
 		}
-	}
+		closeDescriptors(writer, connector)
+		done <- exitCode
+	}()
 
-	return 0, nil
+	return stage{done: done}
+
+}
 
+// finished returns a stage that has already completed with the given exit
+// code, used for commands that could not be started.
+func finished(exitCode int) stage {
+	done := make(chan int, 1)
+	done <- exitCode
+	return stage{done: done}
 }
 
 // closeDescriptors closes each provided *os.File descriptor if it is non-nil
@@ -296,19 +645,111 @@ func closeDescriptors(descriptors ...*os.File) {
 	}
 }
 
-// sync waits for any tracked external commands to finish
-// and resets the external command list. It returns any
-// error returned by external.Wait.
-func (shell *Shell) sync() error {
+// track registers a started external command so that the interrupt handler
+// can forward signals to it while it runs. Commands started by a subshell
+// are registered with the shell it was copied from.
+func (shell *Shell) track(cmd *exec.Cmd) {
+	shell = shell.root()
+	shell.mu.Lock()
+	shell.externals = append(shell.externals, cmd)
+	shell.mu.Unlock()
+}
 
+// untrack removes a finished external command from the tracked list.
+func (shell *Shell) untrack(cmd *exec.Cmd) {
+	shell = shell.root()
 	shell.mu.Lock()
+	for i, external := range shell.externals {
+		if external == cmd {
+			shell.externals = append(shell.externals[:i], shell.externals[i+1:]...)
+			break
+		}
+	}
+	shell.mu.Unlock()
+}
+
+// root returns the shell that runs the subshell shell was copied from, or
+// shell itself if it is not a subshell.
+func (shell *Shell) root() *Shell {
+	for shell.parent != nil {
+		shell = shell.parent
+	}
+	return shell
+}
+
+// subshell returns a copy of the shell for a builtin to run against, so
+// that whatever the builtin changes does not outlive it: its positional
+// parameters, options, aliases, history and completion specifications are
+// copied, its builtins leave the working directory and the environment
+// alone and exit and return only end the copy. Like in bash, the traps of
+// the copy are reset, except those ignoring a signal, and the dispositions
+// of signals are left to the shell.
+func (shell *Shell) subshell() *Shell {
+
+	sub := &Shell{
+		parent:      shell,
+		env:         shell.env,
+		depth:       shell.depth,
+		traps:       make(map[string]string),
+		interactive: shell.interactive,
+		errexit:     shell.errexit,
+		pipefail:    shell.pipefail,
+		xtrace:      shell.xtrace,
+		verbose:     shell.verbose,
+		histexpand:  shell.histexpand,
+		dumpAST:     shell.dumpAST,
+		builtins:    shell.builtins,
+		stdin:       shell.stdin,
+		stdout:      shell.stdout,
+		stderr:      shell.stderr,
+		completer:   shell.completer.Clone(),
+		history:     shell.history.Clone(),
+	}
 
-	err := external.Wait(shell.externals)
-	shell.externals = nil
+	sub.env.Args = slices.Clone(shell.env.Args)
+	sub.env.Aliases = maps.Clone(shell.env.Aliases)
 
+	shell.mu.Lock()
+	for name, action := range shell.traps {
+		if action == "" {
+			sub.traps[name] = action
+		}
+	}
 	shell.mu.Unlock()
 
-	return err
+	sub.registerOptions()
+
+	return sub
+
+}
+
+// wait blocks until every stage of a pipe section has finished and returns
+// the exit code of the last one, mirroring the exit status of a pipeline, or
+// under set -o pipefail the exit code of the last one that failed.
+// The mutex is not held while waiting, so signals can still be forwarded to
+// the running commands.
+func (shell *Shell) wait(stages []stage) int {
+
+	var exitCode int
+
+	for _, stage := range stages {
+		var code int
+		if stage.cmd != nil {
+			var err error
+			code, err = external.Wait(stage.cmd)
+			if err != nil {
+				fmt.Fprintln(shell.stderr, "ebash:", err)
+			}
+			shell.untrack(stage.cmd)
+		} else {
+			code = <-stage.done
+		}
+		if code != 0 || !shell.pipefail {
+			exitCode = code
+		}
+	}
+
+	return exitCode
 
 }
 
@@ -316,6 +757,8 @@ func (shell *Shell) sync() error {
 // and checks for file descriptor leaks relative to the baseline count.
 // The check is performed only every "checkInterval" pipelines; "checkCounter"
 // is incremented on each pipeline execution and reset after the check.
+// Lines of sourced files are not checked, since the source command itself
+// may still hold redirection files open at that point.
 // If more descriptors are open than the baseline, the function panics
 // and reports the PID along with the currently open file descriptors.
 func (shell *Shell) sysmon(err error) {
@@ -326,7 +769,7 @@ func (shell *Shell) sysmon(err error) {
 
 	shell.checkCounter++
 
-	if shell.checkCounter == shell.checkInterval && shell.checkInterval != 0 {
+	if shell.checkCounter >= shell.checkInterval && shell.checkInterval != 0 && shell.depth == 0 {
 
 		pid := os.Getpid()
 		fdDir := fmt.Sprintf("/proc/%d/fd", pid)
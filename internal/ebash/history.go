@@ -0,0 +1,284 @@
+package ebash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"Ebash/internal/history"
+)
+
+// expandHistory performs history expansion on a line read at the prompt
+// (under set -H) and records the result in the history. A line that changed
+// is echoed to stderr before it runs, as bash does. Reports whether the line
+// should be executed: it is not when the expansion fails or ends in ":p".
+func (shell *Shell) expandHistory(line string) (string, bool) {
+
+	printOnly := false
+
+	if shell.histexpand {
+		expanded, onlyPrint, err := shell.history.Expand(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			shell.env.Status = 1
+			return "", false
+		}
+		if expanded != line || onlyPrint {
+			fmt.Fprintln(os.Stderr, expanded)
+		}
+		line, printOnly = expanded, onlyPrint
+	}
+
+	dir, _ := os.Getwd()
+	if shell.history.Add(line, dir) {
+		if err := shell.terminal.SaveHistory(line); err != nil {
+			fmt.Fprintf(os.Stderr, "ebash: history: %v\n", err)
+		}
+	}
+
+	if printOnly {
+		shell.finishHistory(0)
+	}
+
+	return line, !printOnly
+
+}
+
+// finishHistory records the exit status and the duration of the line just
+// executed in its history entry and saves the entry to the history file.
+func (shell *Shell) finishHistory(duration time.Duration) {
+	if err := shell.history.Finish(shell.env.Status, duration); err != nil {
+		fmt.Fprintf(os.Stderr, "ebash: history: %v\n", err)
+	}
+}
+
+// mergeHistory merges the history lines saved by other shells since the
+// last merge, at most once every mergeInterval, and hands the result over to
+// readline.
+func (shell *Shell) mergeHistory() {
+
+	if time.Since(shell.lastMerge) < shell.mergeInterval {
+		return
+	}
+
+	shell.lastMerge = time.Now()
+
+	changed, err := shell.history.Merge()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ebash: history: %v\n", err)
+	}
+
+	if changed {
+		shell.terminal.ResetHistory()
+		shell.syncTerminalHistory(0)
+	}
+
+}
+
+// syncTerminalHistory hands the history entries from index from onwards to
+// readline, so that they can be recalled with the arrow keys.
+func (shell *Shell) syncTerminalHistory(from int) {
+
+	if shell.terminal == nil {
+		return
+	}
+
+	entries, _ := shell.history.Entries()
+	for _, entry := range entries[min(from, len(entries)):] {
+		_ = shell.terminal.SaveHistory(entry.Line)
+	}
+
+}
+
+// manageHistory implements the history builtin:
+//
+//	history [-v] [-F] [-D dir] [n]   list the (last n) entries
+//	history -c                       clear the history
+//	history -d offset                delete an entry (negative counts back from the end)
+//	history -a / -r / -w [file]      append new entries to / read / write the history file
+//
+// -F lists only the lines that failed, -D only those entered in dir, and -v
+// adds the directory, exit status and duration of every entry. When
+// HISTTIMEFORMAT is set, entries are listed with their time formatted by
+// it, as in bash.
+func (shell *Shell) manageHistory(command []string, stdout io.Writer) error {
+
+	var clearAll, appendFile, readFile, writeFile, failed, verbose bool
+	var deleteOffset, dir string
+
+	args := command[1:]
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+
+		arg := args[0]
+		args = args[1:]
+
+		if arg == "--" {
+			break
+		} else if _, err := strconv.Atoi(arg); err == nil {
+			args = append([]string{arg}, args...)
+			break
+		}
+
+		for i, flag := range arg[1:] {
+			switch flag {
+			case 'c':
+				clearAll = true
+			case 'a':
+				appendFile = true
+			case 'r':
+				readFile = true
+			case 'w':
+				writeFile = true
+			case 'F':
+				failed = true
+			case 'v':
+				verbose = true
+			case 'd', 'D':
+				value := arg[i+2:]
+				if value == "" {
+					if len(args) == 0 {
+						return fmt.Errorf("ebash: history: -%c: option requires an argument", flag)
+					}
+					value, args = args[0], args[1:]
+				}
+				if flag == 'd' {
+					deleteOffset = value
+				} else {
+					dir = value
+				}
+			default:
+				return fmt.Errorf("ebash: history: -%c: invalid option\nhistory: usage: history [-c] [-d offset] [-vF] [-D dir] [n] or history -awr [filename]", flag)
+			}
+			if flag == 'd' || flag == 'D' {
+				break
+			}
+		}
+
+	}
+
+	switch {
+	case clearAll:
+		shell.history.Clear()
+		if shell.terminal != nil {
+			shell.terminal.ResetHistory()
+		}
+		return nil
+	case deleteOffset != "":
+		offset, err := strconv.Atoi(deleteOffset)
+		if err != nil {
+			return fmt.Errorf("ebash: history: %s: history position out of range", deleteOffset)
+		}
+		if err := shell.history.Delete(offset); err != nil {
+			return fmt.Errorf("ebash: history: %w", err)
+		}
+		return nil
+	case appendFile || readFile || writeFile:
+		return shell.historyFile(args, appendFile, readFile)
+	}
+
+	if len(args) > 1 {
+		return fmt.Errorf("ebash: history: too many arguments")
+	}
+
+	if dir != "" {
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("ebash: history: %s: %w", dir, err)
+		}
+		dir = absolute
+	}
+
+	count := -1
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("ebash: history: %s: numeric argument required", args[0])
+		}
+		count = n
+	}
+
+	return shell.listHistory(stdout, count, dir, failed, verbose)
+
+}
+
+// historyFile performs the file operations of the history builtin on the
+// file named in args, or on the history file when args is empty.
+func (shell *Shell) historyFile(args []string, appendFile, readFile bool) error {
+
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	if path == "" && shell.history.Path() == "" {
+		return fmt.Errorf("ebash: history: no history file")
+	}
+
+	var err error
+
+	switch {
+	case appendFile:
+		err = shell.history.Append(path)
+	case readFile:
+		before := shell.history.Len()
+		err = shell.history.Read(path)
+		shell.syncTerminalHistory(before)
+	default:
+		err = shell.history.Write(path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("ebash: history: %w", err)
+	}
+
+	return nil
+
+}
+
+// listHistory prints the last count entries (every entry when count is
+// negative) that were entered in dir (any directory when dir is empty) and,
+// if failed is set, finished with a non-zero status.
+func (shell *Shell) listHistory(stdout io.Writer, count int, dir string, failed, verbose bool) error {
+
+	entries, base := shell.history.Entries()
+	timeFormat, timed := os.LookupEnv("HISTTIMEFORMAT")
+
+	var lines []string
+
+	for i, entry := range entries {
+
+		if (dir != "" && entry.Dir != dir) || (failed && entry.Status == 0) {
+			continue
+		}
+
+		var stamp string
+		if timed && !entry.Time.IsZero() {
+			stamp = history.Strftime(timeFormat, entry.Time)
+		}
+
+		line := fmt.Sprintf("%5d  %s%s", base+i, stamp, entry.Line)
+		if verbose && !entry.Time.IsZero() {
+			line += fmt.Sprintf("\t# %s, status %d, %s", entry.Dir, entry.Status, entry.Duration.Round(time.Microsecond))
+		}
+
+		lines = append(lines, line)
+
+	}
+
+	if count >= 0 && count < len(lines) {
+		lines = lines[len(lines)-count:]
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(stdout, line); err != nil {
+			return fmt.Errorf("ebash: history: write operation failed: %w", err)
+		}
+	}
+
+	return nil
+
+}
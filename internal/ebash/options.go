@@ -0,0 +1,284 @@
+package ebash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// option is an entry of the shell option registry: a named switch bound to
+// the field it controls. Most options toggled by set also have a
+// single-letter flag; options toggled by shopt have none.
+type option struct {
+	name  string // long name used by "set -o" and shopt
+	flag  rune   // short flag used by "set -x"/"set +x"; 0 for pipefail and shopt options
+	value *bool  // field holding the state of the option
+}
+
+// registerOptions builds the option registries of the shell: the POSIX
+// options managed by set and the bash-style extended options managed by
+// shopt. Both are kept sorted by name, which is the order they are listed in.
+func (shell *Shell) registerOptions() {
+
+	shell.options = []option{
+		{name: "errexit", flag: 'e', value: &shell.errexit},
+		{name: "histexpand", flag: 'H', value: &shell.histexpand},
+		{name: "noclobber", flag: 'C', value: &shell.env.NoClobber},
+		{name: "noglob", flag: 'f', value: &shell.env.NoGlob},
+		{name: "nounset", flag: 'u', value: &shell.env.NoUnset},
+		{name: "pipefail", value: &shell.pipefail},
+		{name: "verbose", flag: 'v', value: &shell.verbose},
+		{name: "xtrace", flag: 'x', value: &shell.xtrace},
+	}
+
+	shell.shopts = []option{
+		{name: "complete_help", value: &shell.completer.RunHelp},
+		{name: "dotglob", value: &shell.env.DotGlob},
+		{name: "expand_aliases", value: &shell.env.ExpandAliases},
+		{name: "failglob", value: &shell.env.FailGlob},
+		{name: "nocaseglob", value: &shell.env.NoCaseGlob},
+		{name: "nullglob", value: &shell.env.NullGlob},
+	}
+
+}
+
+// lookupOption returns the option called name in the given registry, or nil
+// if there is none.
+func lookupOption(registry []option, name string) *option {
+	for i := range registry {
+		if registry[i].name == name {
+			return &registry[i]
+		}
+	}
+	return nil
+}
+
+// onOff renders the state of an option the way set -o and shopt list it.
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// set implements the set builtin:
+//
+//	set                      list the environment
+//	set -o / set +o          list the options, as a table or as set commands
+//	set -efuvxCH / +efuvxCH  enable / disable options by flag
+//	set -o name / +o name    enable / disable options by name
+//	set [--] args...         replace the positional parameters
+//
+// Flags and named options may be mixed, also within one argument: every "o"
+// of "set -eo pipefail" takes the next argument as the name of an option.
+// The first argument that is not an option (or every argument after "--")
+// becomes a positional parameter.
+func (shell *Shell) set(command []string, stdout, stderr io.Writer) error {
+
+	if len(command) == 1 {
+		environ := os.Environ()
+		sort.Strings(environ)
+		for _, variable := range environ {
+			if _, err := fmt.Fprintln(stdout, variable); err != nil {
+				return fmt.Errorf("ebash: set: write operation failed: %w", err)
+			}
+		}
+		return nil
+	}
+
+	args := command[1:]
+
+	for len(args) > 0 {
+
+		arg := args[0]
+
+		if arg == "--" {
+			shell.env.Args = append([]string{shell.env.Args[0]}, args[1:]...)
+			return nil
+		} else if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+
+		enable := arg[0] == '-'
+		args = args[1:]
+
+		for _, flag := range arg[1:] {
+			if flag == 'o' {
+				if len(args) == 0 {
+					return shell.listOptions(stdout, enable)
+				}
+				opt := lookupOption(shell.options, args[0])
+				if opt == nil {
+					fmt.Fprintf(stderr, "ebash: set: %s: invalid option name\n", args[0])
+					return statusError(2)
+				}
+				*opt.value = enable
+				args = args[1:]
+				continue
+			}
+			i := slices.IndexFunc(shell.options, func(opt option) bool { return opt.flag == flag })
+			if i < 0 {
+				fmt.Fprintf(stderr, "ebash: set: %c%c: invalid option\nset: usage: set [-efuvxCH] [-o option-name] [--] [arg ...]\n", arg[0], flag)
+				return statusError(2)
+			}
+			*shell.options[i].value = enable
+		}
+
+	}
+
+	if len(args) > 0 {
+		shell.env.Args = append([]string{shell.env.Args[0]}, args...)
+	}
+
+	return nil
+
+}
+
+// listOptions prints the state of every set option: as a table for "set -o"
+// or as commands that restore the current state for "set +o".
+func (shell *Shell) listOptions(stdout io.Writer, table bool) error {
+
+	for _, opt := range shell.options {
+
+		var err error
+
+		if table {
+			_, err = fmt.Fprintf(stdout, "%-15s\t%s\n", opt.name, onOff(*opt.value))
+		} else if *opt.value {
+			_, err = fmt.Fprintf(stdout, "set -o %s\n", opt.name)
+		} else {
+			_, err = fmt.Fprintf(stdout, "set +o %s\n", opt.name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("ebash: set: write operation failed: %w", err)
+		}
+
+	}
+
+	return nil
+
+}
+
+// shopt implements the shopt builtin for the extended shell options:
+//
+//	shopt [-p] [name...]     print the state of the options
+//	shopt -s name...         enable the options
+//	shopt -u name...         disable the options
+//	shopt -s|-u              print the options enabled or disabled
+//	shopt -q name...         print nothing, only set the exit status
+//	shopt -o ...             operate on the set options instead
+//
+// When querying, the exit status is 0 only if all named options are enabled.
+func (shell *Shell) shopt(command []string, stdout io.Writer) error {
+
+	var enable, disable, quiet, printCommands bool
+
+	registry := shell.shopts
+	enabledCommand, disabledCommand := "shopt -s", "shopt -u"
+	args := command[1:]
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 's':
+				enable = true
+			case 'u':
+				disable = true
+			case 'q':
+				quiet = true
+			case 'p':
+				printCommands = true
+			case 'o':
+				registry = shell.options
+				enabledCommand, disabledCommand = "set -o", "set +o"
+			default:
+				return fmt.Errorf("ebash: shopt: -%c: invalid option\nshopt: usage: shopt [-pqsu] [-o] [optname ...]", flag)
+			}
+		}
+		args = args[1:]
+	}
+
+	if enable && disable {
+		return fmt.Errorf("ebash: shopt: cannot set and unset shell options simultaneously")
+	}
+
+	selected := registry
+	if len(args) > 0 {
+		selected = nil
+		for _, name := range args {
+			opt := lookupOption(registry, name)
+			if opt == nil {
+				return fmt.Errorf("ebash: shopt: %s: invalid shell option name", name)
+			}
+			selected = append(selected, *opt)
+		}
+	}
+
+	if (enable || disable) && len(args) > 0 {
+		for _, opt := range selected {
+			*opt.value = enable
+		}
+		return nil
+	}
+
+	if enable || disable {
+		selected = slices.DeleteFunc(slices.Clone(selected), func(opt option) bool { return *opt.value != enable })
+	}
+
+	allEnabled := true
+
+	for _, opt := range selected {
+
+		allEnabled = allEnabled && *opt.value
+
+		if quiet {
+			continue
+		}
+
+		var err error
+
+		switch {
+		case printCommands && *opt.value:
+			_, err = fmt.Fprintf(stdout, "%s %s\n", enabledCommand, opt.name)
+		case printCommands:
+			_, err = fmt.Fprintf(stdout, "%s %s\n", disabledCommand, opt.name)
+		default:
+			_, err = fmt.Fprintf(stdout, "%-15s\t%s\n", opt.name, onOff(*opt.value))
+		}
+
+		if err != nil {
+			return fmt.Errorf("ebash: shopt: write operation failed: %w", err)
+		}
+
+	}
+
+	if len(args) > 0 && !allEnabled {
+		return statusError(1)
+	}
+
+	return nil
+
+}
+
+// trace prints a command about to be executed under set -x, prefixed with
+// $PS4 ("+ " when unset). Like bash, it quotes the words that would not be
+// read back as they are.
+func trace(stderr io.Writer, command []string) {
+
+	ps4, ok := os.LookupEnv("PS4")
+	if !ok {
+		ps4 = "+ "
+	}
+
+	words := make([]string, len(command))
+	for i, word := range command {
+		words[i] = quoteWord(word)
+	}
+
+	fmt.Fprintln(stderr, ps4+strings.Join(words, " "))
+
+}
@@ -0,0 +1,42 @@
+package ebash
+
+import (
+	"bytes"
+	"testing"
+
+	"Ebash/internal/completer"
+)
+
+func TestShoptWithoutNames(t *testing.T) {
+
+	shell := &Shell{completer: completer.NewCompleter(nil, nil)}
+	shell.registerOptions()
+	shell.env.NullGlob = true
+	shell.env.ExpandAliases = true
+
+	tests := []struct {
+		command []string
+		output  string
+	}{
+		{[]string{"shopt", "-s"}, "expand_aliases \ton\nnullglob       \ton\n"},
+		{[]string{"shopt", "-u", "-p"}, "shopt -u complete_help\nshopt -u dotglob\nshopt -u failglob\nshopt -u nocaseglob\n"},
+		{[]string{"shopt", "-o", "-s"}, ""},
+	}
+
+	for _, test := range tests {
+
+		var out bytes.Buffer
+		if err := shell.shopt(test.command, &out); err != nil {
+			t.Fatalf("shopt(%q) = %v", test.command, err)
+		}
+		if out.String() != test.output {
+			t.Errorf("shopt(%q) printed %q, want %q", test.command, out.String(), test.output)
+		}
+
+	}
+
+	if !shell.env.NullGlob || shell.env.DotGlob {
+		t.Errorf("shopt changed options without names: nullglob %v, dotglob %v", shell.env.NullGlob, shell.env.DotGlob)
+	}
+
+}
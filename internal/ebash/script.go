@@ -0,0 +1,173 @@
+package ebash
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"Ebash/internal/parser"
+)
+
+// runScript reads the script file at path and executes it line by line.
+// A missing or unreadable script is reported like bash does and leaves
+// status 127 or 126. The file is read in full up front so no descriptor
+// stays open while its commands run.
+func (shell *Shell) runScript(path string) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "ebash: %s: No such file or directory\n", path)
+			shell.env.Status = 127
+		} else {
+			fmt.Fprintf(os.Stderr, "ebash: %s: %v\n", path, err)
+			shell.env.Status = 126
+		}
+		return
+	}
+
+	shell.runLines(bytes.NewReader(data))
+
+}
+
+// runLines executes every line read from reader without any interactive
+// machinery (prompt, completer, history). A leading "#!" shebang line is
+// treated like any other comment. Execution stops at the end of input or
+// once the exit or return builtin has run. Like bash, the shell reads no
+// further than the line it runs, so the commands of a script read from
+// stdin can read the rest of stdin themselves.
+func (shell *Shell) runLines(reader io.Reader) {
+
+	lines := newLineReader(reader)
+
+	for {
+
+		line, err := lines.next()
+		if err == nil || line != "" {
+			shell.execute(line)
+			if shell.exiting || shell.returning {
+				return
+			}
+		}
+
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "ebash: failed to read input: %v\n", err)
+			return
+		}
+
+	}
+
+}
+
+// lineReader reads the lines of a script without consuming the input that
+// follows the line it returns. A regular file is read ahead and moved back
+// to the end of every line returned; any other file, such as a pipe, is
+// read a byte at a time. Other readers are read ahead.
+type lineReader struct {
+	reader *bufio.Reader
+	file   *os.File // regular file moved back after every line; nil otherwise
+}
+
+// newLineReader returns a lineReader reading the lines of reader.
+func newLineReader(reader io.Reader) *lineReader {
+
+	file, ok := reader.(*os.File)
+	if !ok {
+		return &lineReader{reader: bufio.NewReader(reader)}
+	}
+
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		return &lineReader{reader: bufio.NewReader(file), file: file}
+	}
+
+	return &lineReader{reader: bufio.NewReaderSize(byteReader{file}, 16)}
+
+}
+
+// next returns the next line without its line terminator. At the end of
+// input it returns the unterminated rest of the input, possibly empty,
+// along with io.EOF. A regular file is read from wherever the commands run
+// so far left its offset.
+func (lines *lineReader) next() (string, error) {
+
+	if lines.file == nil {
+		line, err := lines.reader.ReadString('\n')
+		return trimNewline(line), err
+	}
+
+	start, err := lines.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+
+	lines.reader.Reset(lines.file)
+	line, err := lines.reader.ReadString('\n')
+
+	if _, seekErr := lines.file.Seek(start+int64(len(line)), io.SeekStart); seekErr != nil && err == nil {
+		err = seekErr
+	}
+
+	return trimNewline(line), err
+
+}
+
+// trimNewline removes the "\n" or "\r\n" ending line.
+func trimNewline(line string) string {
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
+
+// byteReader reads from a file a single byte at a time, so that a
+// bufio.Reader on top of it never reads past the delimiter it looks for.
+type byteReader struct {
+	file *os.File
+}
+
+// Read implements io.Reader.
+func (r byteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.file.Read(p[:1])
+}
+
+// dumpAST writes the structure of a parsed pipeline to w without executing
+// anything: every conditional pipe with the operator that follows it, the
+// commands it is made of as the tokenizer splits them and the redirections
+// of each command. Variables are expanded as they would be at this point,
+// unset ones to nothing even under set -u so that every pipe is shown.
+func dumpAST(w io.Writer, pipeline []parser.Pipe, env parser.Env) {
+
+	env.NoUnset = false
+
+	fmt.Fprintln(w, "Pipeline")
+
+	for _, pipe := range pipeline {
+
+		switch {
+		case pipe.NextAnd:
+			fmt.Fprintln(w, "  Pipe &&")
+		case pipe.NextOr:
+			fmt.Fprintln(w, "  Pipe ||")
+		default:
+			fmt.Fprintln(w, "  Pipe")
+		}
+
+		commands, _ := pipe.Commands(&env)
+
+		for _, command := range commands {
+			fmt.Fprintf(w, "    Command %q\n", command.Words)
+			for _, redirection := range command.Redirections {
+				fmt.Fprintf(w, "      Redirect %s %q\n", redirection.Operator, redirection.Target)
+			}
+		}
+
+	}
+
+}
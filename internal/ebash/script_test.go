@@ -0,0 +1,53 @@
+package ebash
+
+import (
+	"bytes"
+	"testing"
+
+	"Ebash/internal/parser"
+)
+
+func TestDumpAST(t *testing.T) {
+
+	tests := []struct {
+		line string
+		dump string
+	}{
+		{"echo 'a | b' >| f && ls", "Pipeline\n" +
+			"  Pipe &&\n" +
+			"    Command [\"echo\" \"a | b\"]\n" +
+			"      Redirect >| \"f\"\n" +
+			"  Pipe\n" +
+			"    Command [\"ls\"]\n"},
+		{"cat < in \"x|y\"\\|z | wc -l >> out || echo $?", "Pipeline\n" +
+			"  Pipe ||\n" +
+			"    Command [\"cat\" \"x|y|z\"]\n" +
+			"      Redirect < \"in\"\n" +
+			"    Command [\"wc\" \"-l\"]\n" +
+			"      Redirect >> \"out\"\n" +
+			"  Pipe\n" +
+			"    Command [\"echo\" \"2\"]\n"},
+		{"echo $NONEXISTENT_EBASH_VAR >", "Pipeline\n" +
+			"  Pipe\n" +
+			"    Command [\"echo\"]\n" +
+			"      Redirect > \"\"\n"},
+	}
+
+	for _, test := range tests {
+
+		env := parser.Env{Status: 2, NoUnset: true}
+
+		pipeline, err := parser.Parse(test.line, &env)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.line, err)
+		}
+
+		var out bytes.Buffer
+		dumpAST(&out, pipeline, env)
+		if out.String() != test.dump {
+			t.Errorf("dumpAST(%q) =\n%s\nwant\n%s", test.line, out.String(), test.dump)
+		}
+
+	}
+
+}
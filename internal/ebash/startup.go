@@ -0,0 +1,46 @@
+package ebash
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	systemRC    = "/etc/ebash/ebashrc" // system-wide startup file of interactive shells
+	userRC      = ".ebashrc"           // personal startup file of interactive shells, relative to $HOME
+	userProfile = ".ebash_profile"     // personal startup file of login shells, relative to $HOME
+)
+
+// loadStartupFiles executes the startup files that apply to the shell:
+// ~/.ebash_profile for login shells (unless --noprofile was given), then
+// /etc/ebash/ebashrc and ~/.ebashrc for interactive shells (unless --norc
+// was given). The files run through the normal parser and executor in the
+// shell itself, so everything they define stays in effect. Missing files
+// are silently skipped.
+func (shell *Shell) loadStartupFiles(opts Options, interactive bool) {
+
+	home, _ := os.UserHomeDir()
+
+	var files []string
+
+	if opts.Login && !opts.NoProfile && home != "" {
+		files = append(files, filepath.Join(home, userProfile))
+	}
+
+	if interactive && !opts.NoRC {
+		files = append(files, systemRC)
+		if home != "" {
+			files = append(files, filepath.Join(home, userRC))
+		}
+	}
+
+	for _, file := range files {
+		if shell.exiting {
+			return
+		}
+		if _, err := os.Stat(file); err == nil {
+			shell.runScript(file)
+		}
+	}
+
+}
@@ -0,0 +1,333 @@
+package ebash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signalEntry associates a signal name, as used by trap, with its number.
+type signalEntry struct {
+	name   string
+	signal syscall.Signal
+}
+
+// signals lists the signals that can be trapped, in signal number order.
+var signals = []signalEntry{
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"QUIT", syscall.SIGQUIT},
+	{"ILL", syscall.SIGILL},
+	{"TRAP", syscall.SIGTRAP},
+	{"ABRT", syscall.SIGABRT},
+	{"BUS", syscall.SIGBUS},
+	{"FPE", syscall.SIGFPE},
+	{"KILL", syscall.SIGKILL},
+	{"USR1", syscall.SIGUSR1},
+	{"SEGV", syscall.SIGSEGV},
+	{"USR2", syscall.SIGUSR2},
+	{"PIPE", syscall.SIGPIPE},
+	{"ALRM", syscall.SIGALRM},
+	{"TERM", syscall.SIGTERM},
+	{"CHLD", syscall.SIGCHLD},
+	{"CONT", syscall.SIGCONT},
+	{"STOP", syscall.SIGSTOP},
+	{"TSTP", syscall.SIGTSTP},
+	{"TTIN", syscall.SIGTTIN},
+	{"TTOU", syscall.SIGTTOU},
+	{"URG", syscall.SIGURG},
+	{"XCPU", syscall.SIGXCPU},
+	{"XFSZ", syscall.SIGXFSZ},
+	{"VTALRM", syscall.SIGVTALRM},
+	{"PROF", syscall.SIGPROF},
+	{"WINCH", syscall.SIGWINCH},
+	{"IO", syscall.SIGIO},
+	{"SYS", syscall.SIGSYS},
+}
+
+// pseudoSignals lists the conditions that can be trapped besides signals:
+// EXIT runs when the shell exits, DEBUG before every pipe, ERR after a pipe
+// that fails outside of a &&/|| list and RETURN after a sourced file ends.
+var pseudoSignals = []string{"DEBUG", "ERR", "RETURN"}
+
+// interactiveSignals are the signals an interactive shell catches even
+// without a trap: SIGINT is forwarded to running commands, SIGHUP is
+// forwarded and ends the shell, SIGTERM and SIGQUIT are ignored.
+var interactiveSignals = []os.Signal{syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT}
+
+// lookupSignal converts a signal specification ("INT", "SIGINT", "int",
+// "2", "EXIT", "0") into the canonical name used as key of the trap table,
+// and returns the signal itself for real signals (0 for pseudo-signals).
+func lookupSignal(spec string) (string, syscall.Signal, bool) {
+
+	if number, err := strconv.Atoi(spec); err == nil {
+		if number == 0 {
+			return "EXIT", 0, true
+		}
+		for _, entry := range signals {
+			if int(entry.signal) == number {
+				return entry.name, entry.signal, true
+			}
+		}
+		return "", 0, false
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+
+	if name == "EXIT" || slices.Contains(pseudoSignals, name) {
+		return name, 0, true
+	}
+
+	for _, entry := range signals {
+		if entry.name == name {
+			return entry.name, entry.signal, true
+		}
+	}
+
+	return "", 0, false
+
+}
+
+// signalName returns the trap table key of a received signal.
+func signalName(sig os.Signal) string {
+	for _, entry := range signals {
+		if entry.signal == sig {
+			return entry.name
+		}
+	}
+	return sig.String()
+}
+
+// trap implements the trap builtin:
+//
+//	trap [-p] [sigspec...]       print the traps, as commands that restore them
+//	trap -l                      list the signal names and numbers
+//	trap action sigspec...       run action when a signal arrives
+//	trap '' sigspec...           ignore the signals (also in started commands)
+//	trap [-] sigspec...          restore the default handling
+//
+// Besides signals, EXIT, ERR, DEBUG and RETURN can be trapped. Handlers of
+// signals run at the next safe point: once the pipe that was running when
+// the signal arrived has finished, or before the next prompt is shown.
+func (shell *Shell) trap(command []string, stdout io.Writer) error {
+
+	args := command[1:]
+
+	switch {
+	case len(args) == 0:
+		return shell.printTraps(stdout, nil)
+	case args[0] == "-l":
+		return printSignals(stdout)
+	case args[0] == "-p":
+		return shell.printTraps(stdout, args[1:])
+	case args[0] == "--":
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	action, specs := args[0], args[1:]
+	if len(specs) == 0 {
+		action, specs = "-", args
+	}
+
+	var failed error
+
+	for _, spec := range specs {
+
+		name, sig, ok := lookupSignal(spec)
+		if !ok {
+			failed = fmt.Errorf("ebash: trap: %s: invalid signal specification", spec)
+			continue
+		}
+
+		shell.mu.Lock()
+		if action == "-" {
+			delete(shell.traps, name)
+		} else {
+			shell.traps[name] = action
+		}
+		shell.mu.Unlock()
+
+		if sig != 0 && shell.parent == nil {
+			shell.applySignalPolicy(sig, action)
+		}
+
+	}
+
+	return failed
+
+}
+
+// applySignalPolicy updates the disposition of a real signal after its trap
+// changed: an empty action ignores it (started commands inherit that), "-"
+// restores what the shell does by default, anything else catches it.
+// SIGWINCH stays caught whatever the action in an interactive shell, since
+// readline redraws the line through its own handler when the terminal is
+// resized; untrapped, it is dropped like every other untrapped signal.
+func (shell *Shell) applySignalPolicy(sig syscall.Signal, action string) {
+
+	if sig == syscall.SIGWINCH && shell.terminal != nil {
+		signal.Notify(shell.sigCh, sig)
+		return
+	}
+
+	switch action {
+	case "":
+		signal.Ignore(sig)
+	case "-":
+		signal.Reset(sig)
+		if shell.interactive && slices.Contains(interactiveSignals, os.Signal(sig)) {
+			signal.Notify(shell.sigCh, sig)
+		}
+	default:
+		signal.Notify(shell.sigCh, sig)
+	}
+
+}
+
+// printTraps prints the traps for the given specifications, or every trap
+// when specs is empty, as trap commands that would restore them. Signals
+// are named with their SIG prefix, as bash does.
+func (shell *Shell) printTraps(stdout io.Writer, specs []string) error {
+
+	names := []string{"EXIT"}
+	for _, entry := range signals {
+		names = append(names, entry.name)
+	}
+	names = append(names, pseudoSignals...)
+
+	if len(specs) > 0 {
+		names = nil
+		for _, spec := range specs {
+			name, _, ok := lookupSignal(spec)
+			if !ok {
+				return fmt.Errorf("ebash: trap: %s: invalid signal specification", spec)
+			}
+			names = append(names, name)
+		}
+	}
+
+	shell.mu.Lock()
+	defer shell.mu.Unlock()
+
+	for _, name := range names {
+
+		action, ok := shell.traps[name]
+		if !ok {
+			continue
+		}
+
+		if _, sig, _ := lookupSignal(name); sig != 0 {
+			name = "SIG" + name
+		}
+
+		if _, err := fmt.Fprintf(stdout, "trap -- '%s' %s\n", strings.ReplaceAll(action, "'", `'\''`), name); err != nil {
+			return fmt.Errorf("ebash: trap: write operation failed: %w", err)
+		}
+
+	}
+
+	return nil
+
+}
+
+// printSignals lists the trappable signals with their numbers, five per
+// line, the way "trap -l" does in bash.
+func printSignals(stdout io.Writer) error {
+
+	var builder strings.Builder
+
+	for i, entry := range signals {
+		fmt.Fprintf(&builder, "%2d) SIG%s", int(entry.signal), entry.name)
+		if i%5 == 4 || i == len(signals)-1 {
+			builder.WriteString("\n")
+		} else {
+			builder.WriteString("\t")
+		}
+	}
+
+	if _, err := io.WriteString(stdout, builder.String()); err != nil {
+		return fmt.Errorf("ebash: trap: write operation failed: %w", err)
+	}
+
+	return nil
+
+}
+
+// runTraps is called at safe points of the shell loop. It runs the handlers
+// of the signals received since the previous safe point and, after an
+// untrapped SIGHUP, makes the shell exit with status 129. Nothing happens
+// while a trap handler is already running; the signals stay pending.
+func (shell *Shell) runTraps() {
+
+	if shell.inTrap {
+		return
+	}
+
+	shell.mu.Lock()
+	pending, hangup := shell.pending, shell.hangup
+	shell.pending, shell.hangup = nil, false
+	shell.mu.Unlock()
+
+	for _, name := range pending {
+		shell.runTrap(name)
+	}
+
+	if hangup {
+		shell.exiting = true
+		shell.env.Status = 128 + int(syscall.SIGHUP)
+	}
+
+}
+
+// runTrap executes the handler trapped for name, if there is one. The exit
+// status of the interrupted code is preserved unless the handler runs exit.
+// Handlers do not trigger traps themselves.
+func (shell *Shell) runTrap(name string) {
+
+	shell.mu.Lock()
+	action, ok := shell.traps[name]
+	shell.mu.Unlock()
+
+	if !ok || action == "" || shell.inTrap {
+		return
+	}
+
+	status := shell.env.Status
+
+	shell.inTrap = true
+	shell.execute(action)
+	shell.inTrap = false
+
+	if !shell.exiting {
+		shell.env.Status = status
+	}
+
+}
+
+// runExitTrap executes the EXIT trap right before the shell terminates. The
+// handler runs even when the shell is exiting because of the exit builtin,
+// and the final exit status is kept unless the handler runs exit itself.
+func (shell *Shell) runExitTrap() {
+
+	shell.mu.Lock()
+	_, ok := shell.traps["EXIT"]
+	shell.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	shell.exiting, shell.returning = false, false
+	shell.runTrap("EXIT")
+	shell.exiting = true
+
+}
@@ -0,0 +1,133 @@
+// Package editor extends the readline line editor of the interactive ebash
+// shell. It paints the line being edited through the readline Painter
+// interface, follows the edits through the Listener interface and intercepts
+// keys through readline.Config.FuncFilterInputRune to provide what readline
+// lacks, such as syntax highlighting, a fuzzy history search, fish-style
+// autosuggestions and a completion menu.
+package editor
+
+import (
+	"os"
+
+	"github.com/chzyer/readline"
+
+	"Ebash/internal/completer"
+	"Ebash/internal/history"
+	"Ebash/internal/painter"
+)
+
+// Editor hooks into a readline instance. Its methods are called from the
+// readline goroutine while the shell waits for a line, so the state it
+// reads from the shell must not change during Readline.
+type Editor struct {
+	terminal   *readline.Instance      // instance the editor is attached to
+	painter    painter.Painter         // colours of the prompt, reused to highlight the line
+	history    func() []*history.Entry // returns the history entries, oldest first
+	command    func(string) bool       // reports whether a command name can be run
+	commands   map[string]bool         // answers of command for the current prompt
+	paths      map[string]bool         // whether the files named on the current prompt exist
+	prompt     string                  // prompt of the shell, restored after a search
+	dir        string                  // working directory of the shell at the prompt
+	line       []rune                  // line painted last, outside of a search
+	search     *search                 // state of the fuzzy history search; nil when inactive
+	suggestion string                  // rest of the history line suggested for the line painted last
+	complete   completeFunc            // returns the completions of the word before the cursor
+	menu       *menu                   // state of the completion menu; nil when closed
+	menuKey    rune                    // key moving the selection of the menu, handled on the next Tab
+}
+
+// completeFunc returns the position of the word before the cursor of line
+// and the items completing it, as completer.Completer.Complete does.
+type completeFunc func(line []rune, pos int) (int, []completer.Item)
+
+// New returns an Editor that highlights the line with the colours of p,
+// asking command whether command names can be run, that searches the
+// entries returned by entries, and that completes the word before the
+// cursor with complete when Tab is pressed.
+func New(p painter.Painter, entries func() []*history.Entry, command func(string) bool, complete completeFunc) *Editor {
+	return &Editor{
+		painter:  p,
+		history:  entries,
+		command:  command,
+		commands: make(map[string]bool),
+		paths:    make(map[string]bool),
+		complete: complete,
+	}
+}
+
+// Attach installs the editor in the configuration of terminal: it becomes
+// the Painter of the line, the Listener of its changes and its completer,
+// and filters the keys typed, starting the fuzzy history search on Ctrl-R.
+func (e *Editor) Attach(terminal *readline.Instance) {
+	e.terminal = terminal
+	terminal.Config.Painter = e
+	terminal.Config.Listener = e
+	terminal.Config.AutoComplete = e
+	terminal.Config.FuncFilterInputRune = e.filterInputRune
+}
+
+// Do implements readline.AutoCompleter. It offers nothing, leaving Tab to
+// OnChange, which completes with the menu of the editor.
+func (e *Editor) Do(line []rune, pos int) ([][]rune, int) {
+	return nil, 0
+}
+
+// SetPrompt sets the prompt shown for the next line. What the editor
+// learned about commands and files while highlighting the previous line is
+// forgotten, since running it may have changed them, and the working
+// directory is looked up again.
+func (e *Editor) SetPrompt(prompt string) {
+	e.prompt = prompt
+	e.dir, _ = os.Getwd()
+	e.terminal.SetPrompt(prompt)
+	clear(e.commands)
+	clear(e.paths)
+}
+
+// Paint implements readline.Painter. While searching it shows the matching
+// history entries below the query; otherwise the line is highlighted and
+// followed by the dimmed rest of the history line suggested by suggest.
+func (e *Editor) Paint(line []rune, pos int) []rune {
+
+	if e.search != nil {
+		return e.search.paint(line, e.history())
+	}
+
+	e.line = append(e.line[:0], line...)
+	painted := e.highlight(line)
+
+	if e.menu != nil {
+		e.suggestion = ""
+		return e.paintMenu(line, painted)
+	}
+
+	e.suggestion = e.suggest(line, pos)
+	if e.suggestion == "" {
+		return painted
+	}
+
+	return e.paintSuggestion(line, painted)
+
+}
+
+// filterInputRune is called by readline for every key typed, before the key
+// is processed. It returns the key to process and whether to process it at
+// all.
+func (e *Editor) filterInputRune(r rune) (rune, bool) {
+
+	if e.search != nil {
+		return e.searchKey(r)
+	}
+
+	if e.menu != nil {
+		return e.menuKeyTyped(r)
+	}
+
+	if r == readline.CharBckSearch {
+		e.startSearch()
+		return r, false
+	}
+
+	return r, true
+
+}
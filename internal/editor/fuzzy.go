@@ -0,0 +1,86 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fuzzyMatch reports whether the runes of pattern appear in text in order,
+// not necessarily next to each other, and returns a score that is higher for
+// better matches together with the positions of the matched runes. Matching
+// is case-insensitive unless pattern contains an upper-case letter. Runes
+// matched consecutively or at the start of a word score higher, and the
+// tightest occurrence of the pattern is preferred.
+func fuzzyMatch(pattern, text []rune) (int, []int, bool) {
+
+	if len(pattern) == 0 {
+		return 0, nil, true
+	}
+
+	fold := !strings.ContainsFunc(string(pattern), unicode.IsUpper)
+	equal := func(a, b rune) bool {
+		if fold {
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+
+	// Find the first occurrence of the pattern, then walk back from its end
+	// to find the latest position it can start at, which gives the tightest
+	// window containing the whole pattern.
+	end, p := -1, 0
+	for i, r := range text {
+		if equal(r, pattern[p]) {
+			p++
+			if p == len(pattern) {
+				end = i
+				break
+			}
+		}
+	}
+
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	start := end
+	for i, p := end, len(pattern)-1; i >= 0; i-- {
+		if equal(text[i], pattern[p]) {
+			p--
+			if p < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	positions := make([]int, 0, len(pattern))
+	score := 0
+
+	for i, p := start, 0; i <= end && p < len(pattern); i++ {
+
+		if !equal(text[i], pattern[p]) {
+			score--
+			continue
+		}
+
+		score += 16
+		if len(positions) > 0 && positions[len(positions)-1] == i-1 {
+			score += 12
+		}
+		if i == 0 || strings.ContainsRune(" /-_.=|&;", text[i-1]) {
+			score += 8
+		}
+
+		positions = append(positions, i)
+		p++
+
+	}
+
+	if start == 0 {
+		score += 8
+	}
+
+	return score, positions, true
+
+}
@@ -0,0 +1,147 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Ebash/internal/painter"
+	"Ebash/internal/parser"
+)
+
+// underline starts underlined text; existing paths are underlined.
+const underline = "\033[4m"
+
+// Colours of the parts of the line.
+var (
+	knownColour    = painter.Colour("green")
+	unknownColour  = painter.Colour("red")
+	stringColour   = painter.Colour("yellow")
+	variableColour = painter.Colour("cyan")
+	operatorColour = painter.Colour("magenta")
+	commentColour  = suggestionColour
+)
+
+// style is the way a byte of the line is painted.
+type style struct {
+	colour    string
+	bold      bool
+	underline bool
+}
+
+// highlight paints the parts of line found by parser.Lex: the command names,
+// green when they name a builtin, an alias or an executable and red
+// otherwise, the operators, the quoted strings, the variable references, the
+// comments and the arguments naming existing files, which are underlined in
+// the colour of the path in the prompt.
+func (e *Editor) highlight(line []rune) []rune {
+
+	text := string(line)
+	spans := parser.Lex(text)
+	if len(spans) == 0 {
+		return line
+	}
+
+	styles := make([]style, len(text))
+
+	for _, span := range spans {
+		switch span.Kind {
+		case parser.String, parser.Variable:
+			colour := stringColour
+			if span.Kind == parser.Variable {
+				colour = variableColour
+			}
+			for i := span.Start; i < span.End; i++ {
+				styles[i].colour = colour
+			}
+		default:
+			for i := span.Start; i < span.End; i++ {
+				styles[i] = e.style(span)
+			}
+		}
+	}
+
+	var builder strings.Builder
+
+	for start := 0; start < len(text); {
+		end := start + 1
+		for end < len(text) && styles[end] == styles[start] {
+			end++
+		}
+		if styles[start] == (style{}) {
+			builder.WriteString(text[start:end])
+		} else if styles[start].underline {
+			builder.WriteString(e.painter.Paint(styles[start].bold, underline+styles[start].colour, text[start:end]))
+		} else {
+			builder.WriteString(e.painter.Paint(styles[start].bold, styles[start].colour, text[start:end]))
+		}
+		start = end
+	}
+
+	return []rune(builder.String())
+
+}
+
+// style returns the style of a word, an operator or a comment.
+func (e *Editor) style(span parser.Span) style {
+
+	switch span.Kind {
+	case parser.Command:
+		if span.Text == "" {
+			return style{}
+		}
+		if e.isCommand(span.Text) {
+			return style{colour: knownColour}
+		}
+		return style{colour: unknownColour}
+	case parser.Argument:
+		if span.Text != "" && e.exists(span.Text) {
+			return style{colour: e.painter.PathColour, bold: e.painter.PathBold, underline: true}
+		}
+	case parser.Operator:
+		return style{colour: operatorColour, bold: true}
+	case parser.Comment:
+		return style{colour: commentColour}
+	}
+
+	return style{}
+
+}
+
+// isCommand reports whether name can be run, remembering the answer until
+// the next prompt.
+func (e *Editor) isCommand(name string) bool {
+
+	known, ok := e.commands[name]
+	if !ok {
+		known = e.command(name)
+		e.commands[name] = known
+	}
+
+	return known
+
+}
+
+// exists reports whether the file named by path exists, expanding a leading
+// "~" to the home directory. The answer is remembered until the next prompt.
+func (e *Editor) exists(path string) bool {
+
+	found, ok := e.paths[path]
+	if ok {
+		return found
+	}
+
+	name := path
+	if name == "~" || strings.HasPrefix(name, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			name = filepath.Join(home, name[1:])
+		}
+	}
+
+	_, err := os.Stat(name)
+	found = err == nil
+	e.paths[path] = found
+
+	return found
+
+}
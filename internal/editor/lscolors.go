@@ -0,0 +1,119 @@
+package editor
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultLSColours are the colours of GNU ls when $LS_COLORS is not set.
+const defaultLSColours = "di=01;34:ln=01;36:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:" +
+	"su=37;41:sg=30;43:tw=30;42:ow=34;42:st=37;44:ex=01;32"
+
+// lsColours maps the keys of $LS_COLORS, file types ("di", "ex"...) and
+// name patterns ("*.tar"), to the SGR parameters of their colours.
+type lsColours map[string]string
+
+// parseLSColours parses value, in the format of $LS_COLORS, or the colours
+// of GNU ls if it is empty.
+func parseLSColours(value string) lsColours {
+
+	if value == "" {
+		value = defaultLSColours
+	}
+
+	colours := make(lsColours)
+
+	for _, entry := range strings.Split(value, ":") {
+		if key, colour, ok := strings.Cut(entry, "="); ok && key != "" {
+			if strings.HasPrefix(key, "*") {
+				key = strings.ToLower(key)
+			}
+			colours[key] = colour
+		}
+	}
+
+	return colours
+
+}
+
+// colour returns the SGR parameters of the colour of the file at path,
+// whose mode is mode: the colour of its type, or else of the longest
+// pattern its name ends with. Returns "" for files shown uncoloured.
+func (colours lsColours) colour(path string, mode os.FileMode) string {
+
+	key := ""
+
+	switch {
+	case mode&os.ModeSymlink != 0:
+		key = "ln"
+		if _, err := os.Stat(path); err != nil {
+			key = "or"
+		}
+	case mode.IsDir():
+		switch {
+		case mode&os.ModeSticky != 0 && mode.Perm()&0o002 != 0:
+			key = "tw"
+		case mode&os.ModeSticky != 0:
+			key = "st"
+		case mode.Perm()&0o002 != 0:
+			key = "ow"
+		default:
+			key = "di"
+		}
+	case mode&os.ModeNamedPipe != 0:
+		key = "pi"
+	case mode&os.ModeSocket != 0:
+		key = "so"
+	case mode&os.ModeCharDevice != 0:
+		key = "cd"
+	case mode&os.ModeDevice != 0:
+		key = "bd"
+	case mode&os.ModeSetuid != 0:
+		key = "su"
+	case mode&os.ModeSetgid != 0:
+		key = "sg"
+	case mode.Perm()&0o111 != 0:
+		key = "ex"
+	}
+
+	if colour, ok := colours[key]; ok && key != "" {
+		return colour
+	}
+
+	name := strings.ToLower(path)
+	best, colour := 0, colours["fi"]
+	for pattern, value := range colours {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && len(suffix) > best && strings.HasSuffix(name, suffix) {
+			best, colour = len(suffix), value
+		}
+	}
+
+	return colour
+
+}
+
+// fileType describes the type of the file at path, whose mode is mode.
+func fileType(path string, mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "symbolic link"
+		}
+		return "symbolic link to " + target
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	case mode.Perm()&0o111 != 0:
+		return "executable"
+	default:
+		return "file"
+	}
+}
@@ -0,0 +1,311 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+
+	"Ebash/internal/completer"
+)
+
+// menuRows is the number of rows of completions shown below the line.
+const menuRows = 10
+
+// menu is the state of the completion menu, opened when Tab finds several
+// completions. Moving the selection puts the selected completion into the
+// line in place of the word.
+type menu struct {
+	items    []completer.Item // completions of the word
+	start    int              // position of the word in the line, in runes
+	original []rune           // line when the menu was opened
+	pos      int              // position of the cursor in original
+	selected int              // index of the selected item; -1 before one is selected
+	columns  int              // number of columns the items were laid out in last
+	colours  lsColours        // colours of files, from $LS_COLORS
+	modes    map[int]fileInfo // information about the files named by the items shown, by index
+}
+
+// fileInfo describes the file an item names.
+type fileInfo struct {
+	colour      string // SGR parameters of its colour, from $LS_COLORS
+	description string // its type
+}
+
+// tab is called when Tab is pressed, after readline's own completion,
+// which offers nothing. With the menu open, it moves the selection as the
+// key typed says. Otherwise it completes the word before the cursor: a
+// single completion replaces it, several are extended to their longest
+// common beginning if that is longer than the word, and listed in the
+// menu otherwise.
+func (e *Editor) tab(line []rune, pos int) ([]rune, int, bool) {
+
+	if e.menu != nil {
+		return e.moveMenu()
+	}
+
+	if e.complete == nil {
+		return nil, 0, false
+	}
+
+	start, items := e.complete(line, pos)
+
+	switch len(items) {
+	case 0:
+		return nil, 0, false
+	case 1:
+		return replaceWord(line, start, pos, items[0].Text)
+	}
+
+	word := string(line[start:pos])
+	if prefix := commonPrefix(items); len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		return replaceWord(line, start, pos, prefix)
+	}
+
+	e.menu = &menu{
+		items:    items,
+		start:    start,
+		original: append([]rune(nil), line...),
+		pos:      pos,
+		selected: -1,
+		columns:  1,
+		colours:  parseLSColours(os.Getenv("LS_COLORS")),
+		modes:    make(map[int]fileInfo),
+	}
+
+	return line, pos, true
+
+}
+
+// menuKeyTyped handles a key typed while the menu is open. Tab and the
+// arrow keys move the selection: they are turned into Tab, so that readline
+// calls OnChange, and handled there. Enter closes the menu, keeping the
+// selected completion in the line, or runs the line when nothing is
+// selected. Ctrl-G and Ctrl-C close the menu and restore the line as it
+// was. Other keys close the menu and are processed as usual.
+func (e *Editor) menuKeyTyped(r rune) (rune, bool) {
+
+	switch r {
+	case readline.CharTab, readline.CharNext, readline.CharPrev, readline.CharForward, readline.CharBackward,
+		readline.CharBell, readline.CharInterrupt:
+		e.menuKey = r
+		return readline.CharTab, true
+	case readline.CharEnter, readline.CharCtrlJ:
+		selected := e.menu.selected >= 0
+		e.menu = nil
+		return r, !selected
+	}
+
+	e.menu = nil
+
+	return r, true
+
+}
+
+// moveMenu moves the selection of the menu as e.menuKey says and returns
+// the line with the selected completion in place of the word.
+func (e *Editor) moveMenu() ([]rune, int, bool) {
+
+	m := e.menu
+	key := e.menuKey
+	e.menuKey = 0
+
+	if key == readline.CharBell || key == readline.CharInterrupt {
+		e.menu = nil
+		return m.original, m.pos, true
+	}
+
+	delta := 1
+	switch key {
+	case readline.CharBackward:
+		delta = -1
+	case readline.CharNext:
+		delta = m.columns
+	case readline.CharPrev:
+		delta = -m.columns
+	}
+
+	n := len(m.items)
+	switch {
+	case m.selected < 0 && delta > 0:
+		m.selected = 0
+	case m.selected < 0:
+		m.selected = n - 1
+	default:
+		m.selected = ((m.selected+delta)%n + n) % n
+	}
+
+	return replaceWord(m.original, m.start, m.pos, m.items[m.selected].Text)
+
+}
+
+// replaceWord returns line with the runes from start to pos replaced by
+// text, and the position of the cursor after text.
+func replaceWord(line []rune, start, pos int, text string) ([]rune, int, bool) {
+
+	replaced := append(append(append([]rune(nil), line[:start]...), []rune(text)...), line[pos:]...)
+
+	return replaced, start + len([]rune(text)), true
+
+}
+
+// commonPrefix returns the longest beginning the texts of items share.
+func commonPrefix(items []completer.Item) string {
+	prefix := items[0].Text
+	for _, item := range items[1:] {
+		for !strings.HasPrefix(item.Text, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// paintMenu renders line, painted as given, followed by the menu below it.
+// Items with descriptions are listed one per row with their description;
+// others are laid out in a grid, files in their $LS_COLORS colours. At most
+// menuRows rows are shown, scrolled to the selected item, followed by the
+// position of the selection and the type of the selected file.
+func (e *Editor) paintMenu(line, painted []rune) []rune {
+
+	m := e.menu
+
+	width := readline.GetScreenWidth()
+	if width <= 0 {
+		width = 80
+	}
+
+	runes := readline.Runes{}
+
+	described := false
+	nameWidth := 0
+	for _, item := range m.items {
+		described = described || item.Description != ""
+		nameWidth = max(nameWidth, runes.WidthAll([]rune(item.Display)))
+	}
+	nameWidth = min(nameWidth, width/2)
+
+	m.columns = 1
+	if !described {
+		m.columns = max(1, (width-1)/(nameWidth+2))
+	}
+
+	total := (len(m.items) + m.columns - 1) / m.columns
+	first := 0
+	if m.selected >= 0 {
+		first = max(0, m.selected/m.columns-menuRows+1)
+	}
+	last := min(total, first+menuRows)
+
+	var rows []string
+
+	for row := first; row < last; row++ {
+
+		var builder strings.Builder
+
+		for column := 0; column < m.columns; column++ {
+
+			i := row*m.columns + column
+			if i >= len(m.items) {
+				break
+			}
+
+			item := m.items[i]
+			name := truncate(item.Display, nameWidth)
+			padding := strings.Repeat(" ", max(0, nameWidth-runes.WidthAll([]rune(name))))
+
+			style := ""
+			if item.Path != "" {
+				style = m.file(i).colour
+			}
+			if i == m.selected {
+				style += ";7"
+			}
+
+			if style != "" {
+				fmt.Fprintf(&builder, "\033[%sm%s\033[0m", strings.TrimPrefix(style, ";"), name)
+			} else {
+				builder.WriteString(name)
+			}
+
+			if described {
+				description := truncate(item.Description, width-nameWidth-3)
+				fmt.Fprintf(&builder, "%s  %s%s\033[0m", padding, suggestionColour, description)
+			} else {
+				builder.WriteString(padding + "  ")
+			}
+
+		}
+
+		rows = append(rows, builder.String())
+
+	}
+
+	switch status := m.status(); {
+	case m.selected >= 0 && (total > last-first || status != ""):
+		rows = append(rows, fmt.Sprintf("%s%d/%d%s\033[0m", suggestionColour, m.selected+1, len(m.items), status))
+	case total > last-first:
+		rows = append(rows, fmt.Sprintf("%s%d completions\033[0m", suggestionColour, len(m.items)))
+	}
+
+	column := (runes.WidthAll(runes.ColorFilter([]rune(e.prompt))) + runes.WidthAll(line)) % width
+
+	return paintBelow(painted, column, rows)
+
+}
+
+// status describes the selected item when it is a file, by its type.
+func (m *menu) status() string {
+	if m.selected < 0 || m.items[m.selected].Path == "" {
+		return ""
+	}
+	return "  " + m.file(m.selected).description
+}
+
+// file returns information about the file item i names, reading it the
+// first time it is asked for.
+func (m *menu) file(i int) fileInfo {
+
+	if info, ok := m.modes[i]; ok {
+		return info
+	}
+
+	var info fileInfo
+
+	path := m.items[i].Path
+	if stat, err := os.Lstat(path); err == nil {
+		info.colour, info.description = m.colours.colour(path, stat.Mode()), fileType(path, stat.Mode())
+	}
+
+	m.modes[i] = info
+
+	return info
+
+}
+
+// paintBelow renders line, painted, followed by rows on the lines below it.
+// column is the column the line ends at. The rows are drawn after reserving
+// the lines they need, between saving and restoring the cursor position, so
+// that readline keeps the cursor on the line and clears the rows with it.
+func paintBelow(line []rune, column int, rows []string) []rune {
+
+	var builder strings.Builder
+
+	builder.WriteString(string(line))
+	builder.WriteString(strings.Repeat("\n", len(rows)))
+	fmt.Fprintf(&builder, "\033[%dA\r", len(rows))
+	if column > 0 {
+		fmt.Fprintf(&builder, "\033[%dC", column)
+	}
+	builder.WriteString("\0337")
+	for _, row := range rows {
+		builder.WriteString("\r\n\033[K")
+		builder.WriteString(row)
+	}
+	builder.WriteString("\0338")
+
+	return []rune(builder.String())
+
+}
@@ -0,0 +1,259 @@
+package editor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+
+	"Ebash/internal/history"
+)
+
+// searchPrompt replaces the prompt of the shell during a history search.
+const searchPrompt = "\033[1mhistory>\033[0m "
+
+// searchRows is the number of matches listed below the query.
+const searchRows = 8
+
+// charCtrlX is the Ctrl-X key, which readline has no name for.
+const charCtrlX = 24
+
+// search is the state of a fuzzy history search: the line typed is the
+// query, and the history entries matching it are listed below, best first,
+// with details about the selected one.
+type search struct {
+	original []rune   // line being edited when the search started
+	query    string   // query the matches were computed for
+	matches  []result // entries matching the query, best first
+	selected int      // index of the selected match
+	total    int      // number of distinct lines passing the filters
+	fresh    bool     // matches have not been computed yet
+	dir      string   // working directory of the shell
+	here     bool     // only lines entered in dir are searched
+	success  bool     // only lines that exited with status 0 are searched
+}
+
+// result is a history entry matching the query of a search.
+type result struct {
+	entry     *history.Entry
+	score     int
+	positions []int // indexes of the runes of the line matching the query
+}
+
+// startSearch starts a fuzzy history search, keeping the line being edited
+// so that it can be restored when the search is cancelled.
+func (e *Editor) startSearch() {
+	e.search = &search{original: slices.Clone(e.line), fresh: true, dir: e.dir}
+	e.terminal.SetPrompt(searchPrompt)
+	e.terminal.Operation.SetBuffer("")
+}
+
+// stopSearch ends the search and puts line into the editor.
+func (e *Editor) stopSearch(line string) {
+	e.search = nil
+	e.terminal.SetPrompt(e.prompt)
+	e.terminal.Operation.SetBuffer(line)
+}
+
+// searchKey handles a key typed during a search. Ctrl-R and the arrow keys
+// move the selection, Enter runs the selected line, Tab and Right put it
+// into the editor, Ctrl-G and Ctrl-C cancel the search. Ctrl-D toggles the
+// filter on the lines entered in the current directory and Ctrl-X the filter
+// on the lines that succeeded. Other keys edit the query.
+func (e *Editor) searchKey(r rune) (rune, bool) {
+
+	s := e.search
+
+	switch r {
+	case readline.CharBckSearch, readline.CharNext:
+		s.move(1)
+	case readline.CharPrev, readline.CharFwdSearch:
+		s.move(-1)
+	case readline.CharEnter, readline.CharCtrlJ:
+		if line, ok := s.selection(); ok {
+			e.stopSearch(line)
+		} else {
+			e.stopSearch(string(s.original))
+		}
+		return r, true
+	case readline.CharTab, readline.CharForward:
+		if line, ok := s.selection(); ok {
+			e.stopSearch(line)
+		} else {
+			e.stopSearch(string(s.original))
+		}
+	case readline.CharBell, readline.CharInterrupt:
+		e.stopSearch(string(s.original))
+	case readline.CharDelete:
+		s.here, s.fresh = !s.here, true
+	case charCtrlX:
+		s.success, s.fresh = !s.success, true
+	default:
+		return r, true
+	}
+
+	return r, false
+
+}
+
+// move moves the selection by delta matches, wrapping around the list.
+func (s *search) move(delta int) {
+	if len(s.matches) > 0 {
+		s.selected = (s.selected + delta + len(s.matches)) % len(s.matches)
+	}
+}
+
+// selection returns the line of the selected match.
+func (s *search) selection() (string, bool) {
+	if s.selected >= len(s.matches) {
+		return "", false
+	}
+	return s.matches[s.selected].entry.Line, true
+}
+
+// update computes the matches of query among the entries passing the
+// filters of the search. Every line appears once, represented by its most
+// recent entry. Better matches come first; among equal matches, the most
+// recent does.
+func (s *search) update(query string, entries []*history.Entry) {
+
+	if !s.fresh && query == s.query {
+		return
+	}
+
+	s.query, s.fresh, s.selected = query, false, 0
+	s.matches = s.matches[:0]
+
+	pattern := []rune(query)
+	seen := make(map[string]bool)
+
+	for i := len(entries) - 1; i >= 0; i-- {
+
+		entry := entries[i]
+		if seen[entry.Line] || (s.here && entry.Dir != s.dir) || (s.success && entry.Status != 0) {
+			continue
+		}
+		seen[entry.Line] = true
+
+		if score, positions, ok := fuzzyMatch(pattern, []rune(entry.Line)); ok {
+			s.matches = append(s.matches, result{entry: entry, score: score, positions: positions})
+		}
+
+	}
+
+	s.total = len(seen)
+
+	slices.SortStableFunc(s.matches, func(a, b result) int {
+		return b.score - a.score
+	})
+
+}
+
+// paint renders the query followed by the list of matches and a preview of
+// the selected entry below it. The list is drawn after reserving the lines
+// it needs, between saving and restoring the cursor position, so that
+// readline keeps the cursor on the query and clears the list with the line.
+func (s *search) paint(line []rune, entries []*history.Entry) []rune {
+
+	s.update(string(line), entries)
+
+	width := readline.GetScreenWidth()
+	if width <= 0 {
+		width = 80
+	}
+
+	first := max(0, s.selected-searchRows+1)
+	last := min(len(s.matches), first+searchRows)
+
+	var rows []string
+
+	rows = append(rows, s.header())
+
+	for i := first; i < last; i++ {
+		rows = append(rows, s.row(i, width))
+	}
+
+	if s.selected < len(s.matches) {
+		rows = append(rows, "\033[2m  "+truncate(preview(s.matches[s.selected].entry), width-2)+"\033[0m")
+	}
+
+	runes := readline.Runes{}
+	column := (runes.WidthAll(runes.ColorFilter([]rune(searchPrompt))) + runes.WidthAll(line)) % width
+
+	return paintBelow(line, column, rows)
+
+}
+
+// header renders the number of matches followed by the keys toggling the
+// filters, the active ones highlighted.
+func (s *search) header() string {
+
+	filter := func(key, name string, active bool) string {
+		if active {
+			return "  \033[22;1m" + key + " " + name + "\033[0;2m"
+		}
+		return "  " + key + " " + name
+	}
+
+	return fmt.Sprintf("\033[2m  %d/%d%s%s\033[0m", len(s.matches), s.total,
+		filter("^D", "here", s.here),
+		filter("^X", "exit 0", s.success),
+	)
+
+}
+
+// row renders match i of the list, with the runes matching the query
+// highlighted and a marker in front of the selected match.
+func (s *search) row(i, width int) string {
+
+	match := s.matches[i]
+	text := []rune(truncate(match.entry.Line, width-2))
+
+	var builder strings.Builder
+
+	if i == s.selected {
+		builder.WriteString("\033[1m> ")
+	} else {
+		builder.WriteString("  ")
+	}
+
+	for j, r := range text {
+		if slices.Contains(match.positions, j) {
+			builder.WriteString("\033[33m" + string(r) + "\033[39m")
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+
+	builder.WriteString("\033[0m")
+
+	return builder.String()
+
+}
+
+// preview describes the circumstances a history entry ran in.
+func preview(entry *history.Entry) string {
+
+	if entry.Time.IsZero() {
+		return entry.Line
+	}
+
+	return fmt.Sprintf("%s · %s · exit %d · %s",
+		entry.Time.Local().Format("2006-01-02 15:04"),
+		entry.Dir,
+		entry.Status,
+		entry.Duration.Round(time.Millisecond),
+	)
+
+}
+
+// truncate shortens text to at most width runes, marking the cut with "…".
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if width < 1 || len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-1]) + "…"
+}
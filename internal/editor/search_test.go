@@ -0,0 +1,50 @@
+package editor
+
+import (
+	"slices"
+	"testing"
+
+	"Ebash/internal/history"
+)
+
+func TestSearchFilters(t *testing.T) {
+
+	entries := []*history.Entry{
+		{Line: "make test", Dir: "/src", Status: 2},
+		{Line: "make", Dir: "/src"},
+		{Line: "make clean", Dir: "/tmp"},
+		{Line: "make test", Dir: "/tmp"},
+	}
+
+	tests := []struct {
+		here, success bool
+		lines         []string
+	}{
+		{false, false, []string{"make", "make test", "make clean"}},
+		{true, false, []string{"make", "make test"}},
+		{false, true, []string{"make", "make test", "make clean"}},
+		{true, true, []string{"make"}},
+	}
+
+	for _, test := range tests {
+
+		s := &search{dir: "/src", here: test.here, success: test.success, fresh: true}
+		s.update("make", entries)
+
+		var lines []string
+		for _, match := range s.matches {
+			lines = append(lines, match.entry.Line)
+		}
+
+		slices.Sort(lines)
+		slices.Sort(test.lines)
+		if !slices.Equal(lines, test.lines) {
+			t.Errorf("update with here=%v success=%v = %q, want %q", test.here, test.success, lines, test.lines)
+		}
+		if s.total != len(test.lines) {
+			t.Errorf("update with here=%v success=%v counted %d lines, want %d", test.here, test.success, s.total, len(test.lines))
+		}
+
+	}
+
+}
@@ -0,0 +1,123 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// suggestionColour is the style of the suggested completion of the line.
+const suggestionColour = "\033[90m"
+
+// suggest returns the rest of the most recent history line entered in the
+// working directory of the shell that starts with line, or else of the most
+// recent one entered anywhere, or "" if there is none. Suggestions are only
+// made for a line that is not blank, while the cursor is at its end.
+func (e *Editor) suggest(line []rune, pos int) string {
+
+	if pos != len(line) || strings.TrimSpace(string(line)) == "" {
+		return ""
+	}
+
+	prefix := string(line)
+	entries := e.history()
+
+	var elsewhere string
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		candidate := entries[i].Line
+		if len(candidate) <= len(prefix) || !strings.HasPrefix(candidate, prefix) {
+			continue
+		}
+		if e.dir != "" && entries[i].Dir == e.dir {
+			return candidate[len(prefix):]
+		}
+		if elsewhere == "" {
+			elsewhere = candidate[len(prefix):]
+		}
+	}
+
+	return elsewhere
+
+}
+
+// paintSuggestion renders line, painted as given, followed by the dimmed
+// suggestion. The suggestion is cut at the edge of the terminal and written
+// between saving and restoring the cursor position, so that the cursor stays
+// where readline expects it.
+func (e *Editor) paintSuggestion(line, painted []rune) []rune {
+
+	width := readline.GetScreenWidth()
+	if width <= 0 {
+		width = 80
+	}
+
+	runes := readline.Runes{}
+	prompt := []rune(e.prompt)
+	if newline := strings.LastIndexByte(e.prompt, '\n'); newline >= 0 {
+		prompt = []rune(e.prompt[newline+1:])
+	}
+
+	used := (runes.WidthAll(runes.ColorFilter(prompt)) + runes.WidthAll(line)) % width
+	room := width - used - 1
+	if room <= 0 {
+		return painted
+	}
+
+	suggestion := []rune(e.suggestion)
+	if len(suggestion) > room {
+		suggestion = suggestion[:room]
+	}
+
+	painted = append(painted, []rune("\0337"+suggestionColour)...)
+	painted = append(painted, suggestion...)
+	painted = append(painted, []rune("\033[0m\0338")...)
+
+	return painted
+
+}
+
+// OnChange implements readline.Listener. Tab completes the word before the
+// cursor or moves in the completion menu. Right or End at the end of the
+// line accepts the whole suggestion, Alt-F accepts its next word.
+func (e *Editor) OnChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+
+	if key == readline.CharTab && e.search == nil {
+		return e.tab(line, pos)
+	}
+
+	if e.search != nil || e.suggestion == "" || pos != len(line) {
+		return nil, 0, false
+	}
+
+	var accepted string
+
+	switch key {
+	case readline.CharForward, readline.CharLineEnd:
+		accepted = e.suggestion
+	case readline.MetaForward:
+		accepted = nextWord(e.suggestion)
+	default:
+		return nil, 0, false
+	}
+
+	line = append(line, []rune(accepted)...)
+
+	return line, len(line), true
+
+}
+
+// nextWord returns the beginning of text up to the end of its first word,
+// including the blanks before it.
+func nextWord(text string) string {
+	start := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+	if start < 0 {
+		return text
+	}
+	end := strings.IndexFunc(text[start:], unicode.IsSpace)
+	if end < 0 {
+		return text
+	}
+	return text[:start+end]
+}
@@ -0,0 +1,40 @@
+package editor
+
+import (
+	"testing"
+
+	"Ebash/internal/history"
+)
+
+func TestSuggest(t *testing.T) {
+
+	entries := []*history.Entry{
+		{Line: "make test", Dir: "/src"},
+		{Line: "make clean", Dir: "/tmp"},
+		{Line: "make", Dir: "/src"},
+		{Line: "git status"},
+	}
+
+	tests := []struct {
+		dir        string
+		line       string
+		suggestion string
+	}{
+		{"/src", "make", " test"},
+		{"/tmp", "make", " clean"},
+		{"/home", "make", " clean"},
+		{"", "make t", "est"},
+		{"/src", "git", " status"},
+		{"/src", "make test", ""},
+		{"/src", " ", ""},
+	}
+
+	for _, test := range tests {
+		e := &Editor{dir: test.dir, history: func() []*history.Entry { return entries }}
+		line := []rune(test.line)
+		if suggestion := e.suggest(line, len(line)); suggestion != test.suggestion {
+			t.Errorf("suggest(%q) in %q = %q, want %q", test.line, test.dir, suggestion, test.suggestion)
+		}
+	}
+
+}
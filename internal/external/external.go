@@ -4,46 +4,36 @@
 package external
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"syscall"
 
 	"golang.org/x/term"
 )
 
-// Execute starts an external command defined by the command slice.
-// It configures standard input and output depending on the provided
-// connector (previous pipe), inputFile/outputFile (for redirection),
-// and whether this command is the last in the pipeline.
+// Execute starts an external command defined by the command slice with its
+// standard input, output and error attached to stdin, stdout and stderr.
+// The caller resolves these from the pipeline connectors and redirection
+// files, so builtins and external commands share the same wiring.
 //
 // For "ls" and "grep", if the output is a terminal, "--color=auto" is added
 // so that colors appear in interactive mode but do not pollute pipes or files.
 // This ensures correct behavior in interactive shells while preserving clean
 // output for redirection, testing, or diff comparisons with real Bash.
-func Execute(command []string, writer, connector, inputFile, outputFile *os.File, isLast bool) (*exec.Cmd, error) {
+func Execute(command []string, stdin, stdout, stderr *os.File) (*exec.Cmd, error) {
 
 	args := command[1:]
-	if (command[0] == "ls" || command[0] == "grep") && term.IsTerminal(int(os.Stdout.Fd())) {
+	if (command[0] == "ls" || command[0] == "grep") && term.IsTerminal(int(stdout.Fd())) {
 		args = append([]string{"--color=auto"}, args...)
 	}
 
 	cmd := exec.Command(command[0], args...)
-	cmd.Stderr = os.Stderr
-
-	if connector != nil {
-		cmd.Stdin = connector
-	} else if inputFile != nil {
-		cmd.Stdin = inputFile
-	} else {
-		cmd.Stdin = os.Stdin
-	}
-
-	if !isLast {
-		cmd.Stdout = writer
-	} else if outputFile != nil {
-		cmd.Stdout = outputFile
-	} else {
-		cmd.Stdout = os.Stdout
-	}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
@@ -52,16 +42,42 @@ func Execute(command []string, writer, connector, inputFile, outputFile *os.File
 	return cmd, nil
 }
 
-// Wait blocks until all provided external commands have finished.
-// It returns the last non-nil error observed, or nil if all commands
-// exited successfully. This mirrors pipeline behavior: all processes
-// are waited on, but the last error is returned for reporting.
-func Wait(externals []*exec.Cmd) error {
-	var lastErr error
-	for _, command := range externals {
-		if err := command.Wait(); err != nil {
-			lastErr = err
+// Wait blocks until the provided external command has finished and returns
+// its exit status the way bash reports it: the exit code for a normal exit
+// and 128+N for a command terminated by signal N. A non-nil error is returned
+// only when waiting itself fails.
+func Wait(cmd *exec.Cmd) (int, error) {
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				return 128 + int(status.Signal()), nil
+			}
+			return exitErr.ExitCode(), nil
 		}
+		return 1, err
 	}
-	return lastErr
+	return 0, nil
+}
+
+// Failure converts an error returned by Execute into the message and exit
+// status bash reports for it: 127 when the command cannot be found and 126
+// when it exists but cannot be executed.
+func Failure(name string, err error) (string, int) {
+
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, exec.ErrDot):
+		return fmt.Sprintf("ebash: %s: command not found", name), 127
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Sprintf("ebash: %s: No such file or directory", name), 127
+	case errors.Is(err, syscall.ENOEXEC):
+		return fmt.Sprintf("ebash: %s: cannot execute binary file: Exec format error", name), 126
+	case errors.Is(err, fs.ErrPermission):
+		if info, statErr := os.Stat(name); statErr == nil && info.IsDir() {
+			return fmt.Sprintf("ebash: %s: Is a directory", name), 126
+		}
+		return fmt.Sprintf("ebash: %s: Permission denied", name), 126
+	}
+
+	return fmt.Sprintf("ebash: %s: %v", name, err), 126
+
 }
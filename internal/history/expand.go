@@ -0,0 +1,463 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expand performs csh-style history expansion on a command line:
+//
+//	!!          the previous command        !n, !-n     command n, n-th previous
+//	!prefix     last command starting so    !?text[?]   last command containing text
+//	^old^new^   the previous command with the first "old" replaced by "new"
+//
+// An event may be followed by a word designator (":0", ":2", ":^", ":$",
+// ":*", ":2-3", ":2*", ":2-"; the colon is optional before ^, $ and *, so
+// that "!$" and "!*" refer to the previous command) and by modifiers:
+//
+//	:h  remove the last path component   :t  keep only the last path component
+//	:r  remove the file name suffix      :e  keep only the file name suffix
+//	:s/old/new/  replace "old" by "new"  :gs/old/new/  replace every "old"
+//	:&  repeat the last substitution     :q  quote the result
+//	:p  print the result, do not run it
+//
+// A "!" followed by a blank, "=", "(" or the end of the line is taken
+// literally, as is "$!", and nothing is expanded inside single quotes or
+// after a backslash. Expand returns the expanded line and whether it should
+// only be printed (because of ":p"). Errors are formatted the way the shell
+// reports them.
+func (h *History) Expand(line string) (string, bool, error) {
+
+	if strings.HasPrefix(line, "^") {
+		return h.quickSubstitution(line)
+	}
+
+	var builder strings.Builder
+	var single, double, printOnly bool
+
+	for i := 0; i < len(line); i++ {
+
+		char := line[i]
+
+		switch {
+		case char == '\\' && !single && i+1 < len(line):
+			builder.WriteString(line[i : i+2])
+			i++
+			continue
+		case char == '\'' && !double:
+			single = !single
+		case char == '"' && !single:
+			double = !double
+		case char == '!' && !single && i+1 < len(line) && !strings.ContainsRune(" \t\n=(", rune(line[i+1])) && !(double && line[i+1] == '"') && !(i > 0 && line[i-1] == '$'):
+			text, length, onlyPrint, err := h.expandReference(line[i:])
+			if err != nil {
+				return "", false, err
+			}
+			builder.WriteString(text)
+			printOnly = printOnly || onlyPrint
+			i += length - 1
+			continue
+		}
+
+		builder.WriteByte(char)
+
+	}
+
+	return builder.String(), printOnly, nil
+
+}
+
+// quickSubstitution expands "^old^new^rest", which stands for the previous
+// command with the first occurrence of old replaced by new, followed by rest.
+func (h *History) quickSubstitution(line string) (string, bool, error) {
+
+	previous, ok := h.event(-1)
+	if !ok {
+		return "", false, fmt.Errorf("ebash: !!: event not found")
+	}
+
+	parts := strings.SplitN(line[1:], "^", 3)
+	old, replacement, rest := parts[0], "", ""
+	if len(parts) > 1 {
+		replacement = parts[1]
+	}
+	if len(parts) > 2 {
+		rest = parts[2]
+	}
+
+	expanded, ok := h.substitute(previous, old, replacement, false)
+	if !ok {
+		return "", false, fmt.Errorf("ebash: :s%s: substitution failed", line)
+	}
+
+	return expanded + rest, false, nil
+
+}
+
+// expandReference expands the history reference at the start of s, which
+// begins with "!". Returns the replacement text, the number of bytes of s
+// the reference occupies and whether ":p" was among its modifiers.
+func (h *History) expandReference(s string) (string, int, bool, error) {
+
+	line, pos, err := h.parseEvent(s)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	words := splitWords(line)
+	text := line
+
+	if designator, length := wordDesignator(s[pos:]); length > 0 {
+		selected, ok := selectWords(words, designator)
+		if !ok {
+			return "", 0, false, fmt.Errorf("ebash: %s: bad word specifier", s[pos:pos+length])
+		}
+		text = selected
+		pos += length
+	}
+
+	var printOnly bool
+
+	for pos+1 < len(s) && s[pos] == ':' {
+
+		modifier := s[pos+1]
+		pos += 2
+
+		switch modifier {
+		case 'h':
+			if slash := strings.LastIndexByte(text, '/'); slash > 0 {
+				text = text[:slash]
+			} else if slash == 0 {
+				text = "/"
+			}
+		case 't':
+			text = text[strings.LastIndexByte(text, '/')+1:]
+		case 'r':
+			if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+				text = text[:dot]
+			}
+		case 'e':
+			if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+				text = text[dot:]
+			} else {
+				text = ""
+			}
+		case 'p':
+			printOnly = true
+		case 'q':
+			text = "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+		case '&':
+			text, _ = h.substitute(text, h.lastOld, h.lastNew, false)
+		case 's', 'g':
+			global := modifier == 'g'
+			if global {
+				if pos >= len(s) || (s[pos] != 's' && s[pos] != '&') {
+					return "", 0, false, fmt.Errorf("ebash: :g: unrecognized history modifier")
+				}
+				pos++
+				if s[pos-1] == '&' {
+					text, _ = h.substitute(text, h.lastOld, h.lastNew, true)
+					break
+				}
+			}
+			old, replacement, length := parseSubstitution(s[pos:])
+			pos += length
+			if old == "" {
+				old = h.lastOld
+			}
+			var ok bool
+			if text, ok = h.substitute(text, old, replacement, global); !ok {
+				return "", 0, false, fmt.Errorf("ebash: :s/%s/%s/: substitution failed", old, replacement)
+			}
+		default:
+			return "", 0, false, fmt.Errorf("ebash: :%c: unrecognized history modifier", modifier)
+		}
+
+	}
+
+	return text, pos, printOnly, nil
+
+}
+
+// parseEvent resolves the event designator at the start of s, which begins
+// with "!". Returns the command line it refers to and the position right
+// after the designator.
+func (h *History) parseEvent(s string) (string, int, error) {
+
+	var line string
+	var ok bool
+	var pos int
+
+	switch {
+	case s[1] == '!':
+		line, ok = h.event(-1)
+		pos = 2
+	case strings.IndexByte("^$*:", s[1]) >= 0:
+		line, ok = h.event(-1)
+		pos = 1
+	case s[1] == '-' || (s[1] >= '0' && s[1] <= '9'):
+		pos = 2
+		for pos < len(s) && s[pos] >= '0' && s[pos] <= '9' {
+			pos++
+		}
+		n, err := strconv.Atoi(s[1:pos])
+		if err != nil {
+			return "", 0, fmt.Errorf("ebash: %s: event not found", s[:pos])
+		}
+		if n > 0 {
+			line, ok = h.number(n)
+		} else if n < 0 {
+			line, ok = h.event(n)
+		}
+	case s[1] == '?':
+		end := strings.IndexByte(s[2:], '?')
+		text := s[2:]
+		pos = len(s)
+		if end >= 0 {
+			text, pos = s[2:2+end], 3+end
+		}
+		line, ok = h.search(func(entry string) bool { return strings.Contains(entry, text) })
+	default:
+		pos = 1
+		for pos < len(s) && !strings.ContainsRune(" \t\n:;|&<>()\"'", rune(s[pos])) {
+			pos++
+		}
+		prefix := s[1:pos]
+		line, ok = h.search(func(entry string) bool { return strings.HasPrefix(entry, prefix) })
+	}
+
+	if !ok {
+		return "", 0, fmt.Errorf("ebash: %s: event not found", s[:pos])
+	}
+
+	return line, pos, nil
+
+}
+
+// event returns the n-th previous entry for a negative n (-1 is the last).
+func (h *History) event(n int) (string, bool) {
+	if -n > len(h.entries) {
+		return "", false
+	}
+	return h.entries[len(h.entries)+n].Line, true
+}
+
+// number returns the entry numbered n.
+func (h *History) number(n int) (string, bool) {
+	if n < h.base || n-h.base >= len(h.entries) {
+		return "", false
+	}
+	return h.entries[n-h.base].Line, true
+}
+
+// search returns the most recent entry satisfying match.
+func (h *History) search(match func(string) bool) (string, bool) {
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if match(h.entries[i].Line) {
+			return h.entries[i].Line, true
+		}
+	}
+	return "", false
+}
+
+// substitute replaces the first (or, when global is set, every) occurrence
+// of old in text by replacement, in which "&" stands for old itself. The
+// substitution is remembered for ":&". Reports false when old does not occur.
+func (h *History) substitute(text, old, replacement string, global bool) (string, bool) {
+
+	if old == "" || !strings.Contains(text, old) {
+		return text, false
+	}
+
+	h.lastOld, h.lastNew = old, replacement
+	replacement = strings.ReplaceAll(replacement, "&", old)
+
+	if global {
+		return strings.ReplaceAll(text, old, replacement), true
+	}
+
+	return strings.Replace(text, old, replacement, 1), true
+
+}
+
+// parseSubstitution parses the "/old/new/" part of a ":s" modifier, where
+// any character may replace "/" and the final delimiter may be omitted at
+// the end of the line. Returns old, new and the length of the text parsed.
+func parseSubstitution(s string) (string, string, int) {
+
+	if s == "" {
+		return "", "", 0
+	}
+
+	delimiter := s[0]
+	fields := make([]string, 0, 2)
+	pos := 1
+
+	for len(fields) < 2 {
+		end := strings.IndexByte(s[pos:], delimiter)
+		if end < 0 {
+			fields = append(fields, s[pos:])
+			pos = len(s)
+			break
+		}
+		fields = append(fields, s[pos:pos+end])
+		pos += end + 1
+	}
+
+	if len(fields) < 2 {
+		fields = append(fields, "")
+	}
+
+	return fields[0], fields[1], pos
+
+}
+
+// wordDesignator returns the word designator at the start of s (without its
+// colon) and the length it occupies in s, or 0 if s does not start with one.
+func wordDesignator(s string) (string, int) {
+
+	if s == "" {
+		return "", 0
+	}
+
+	start := 0
+	if s[0] == ':' {
+		start = 1
+	}
+
+	if start >= len(s) {
+		return "", 0
+	}
+
+	if start == 0 && strings.IndexByte("^$*", s[0]) < 0 {
+		return "", 0
+	} else if start == 1 && strings.IndexByte("0123456789^$*-", s[1]) < 0 {
+		return "", 0
+	}
+
+	end := start
+	for end < len(s) && strings.IndexByte("0123456789^$*-", s[end]) >= 0 {
+		end++
+	}
+
+	return s[start:end], end
+
+}
+
+// selectWords applies a word designator to the words of a command line:
+// "n" is word n, "^" is word 1, "$" is the last word, "x-y" is a range, "x*"
+// abbreviates "x-$", "*" is "1-$" (and empty when there are no arguments)
+// and "x-" is "x-$" without the last word.
+func selectWords(words []string, designator string) (string, bool) {
+
+	last := len(words) - 1
+
+	if designator == "*" {
+		if last < 1 {
+			return "", true
+		}
+		return strings.Join(words[1:], " "), true
+	}
+
+	parse := func(s string) (int, bool) {
+		switch s {
+		case "^":
+			return 1, true
+		case "$":
+			return last, true
+		}
+		n, err := strconv.Atoi(s)
+		return n, err == nil
+	}
+
+	from, to := designator, designator
+	rangeEnd := ""
+
+	switch {
+	case strings.HasSuffix(designator, "*"):
+		from, rangeEnd = designator[:len(designator)-1], "$"
+	case strings.HasPrefix(designator, "-"):
+		from, rangeEnd = "0", designator[1:]
+	case strings.Contains(designator, "-"):
+		from, rangeEnd, _ = strings.Cut(designator, "-")
+		if rangeEnd == "" {
+			rangeEnd = strconv.Itoa(last - 1)
+		}
+	}
+
+	if rangeEnd != "" {
+		to = rangeEnd
+	}
+
+	first, ok := parse(from)
+	if !ok {
+		return "", false
+	}
+	end, ok := parse(to)
+	if !ok {
+		return "", false
+	}
+
+	if first < 0 || end > last || first > end+1 || (first > end && !strings.HasSuffix(designator, "*")) {
+		return "", false
+	}
+
+	return strings.Join(words[first:end+1], " "), true
+
+}
+
+// splitWords splits a command line into words the way the history sees
+// them: unquoted blanks separate words and runs of the metacharacters
+// "|&;<>()" form words of their own. Quotes are kept in the words.
+func splitWords(line string) []string {
+
+	var words []string
+	var word strings.Builder
+	var quote byte
+
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+
+		char := line[i]
+
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\\' && i+1 < len(line):
+			word.WriteByte(char)
+			i++
+			char = line[i]
+		case char == '\'' || char == '"':
+			quote = char
+		case char == ' ' || char == '\t' || char == '\n':
+			flush()
+			continue
+		case strings.IndexByte("|&;<>()", char) >= 0:
+			flush()
+			end := i + 1
+			for end < len(line) && line[end] == char {
+				end++
+			}
+			words = append(words, line[i:end])
+			i = end - 1
+			continue
+		}
+
+		word.WriteByte(char)
+
+	}
+
+	flush()
+
+	return words
+
+}
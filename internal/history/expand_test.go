@@ -0,0 +1,101 @@
+package history
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+
+	lines := []string{
+		"ls -l /usr/local/lib/file.tar.gz",
+		"echo 'a b' c | wc -l",
+		"cp src/main.go dst/main.go",
+	}
+
+	tests := []struct {
+		line      string
+		expanded  string
+		printOnly bool
+		err       string
+	}{
+		// events
+		{"!!", "cp src/main.go dst/main.go", false, ""},
+		{"sudo !! -v", "sudo cp src/main.go dst/main.go -v", false, ""},
+		{"!1", "ls -l /usr/local/lib/file.tar.gz", false, ""},
+		{"!-2", "echo 'a b' c | wc -l", false, ""},
+		{"!ls", "ls -l /usr/local/lib/file.tar.gz", false, ""},
+		{"!?tar?", "ls -l /usr/local/lib/file.tar.gz", false, ""},
+		{"!?wc", "echo 'a b' c | wc -l", false, ""},
+		{"true && !e", "true && echo 'a b' c | wc -l", false, ""},
+		{"!nope", "", false, "ebash: !nope: event not found"},
+		{"!9", "", false, "ebash: !9: event not found"},
+		{"!-4", "", false, "ebash: !-4: event not found"},
+
+		// word designators
+		{"!$", "dst/main.go", false, ""},
+		{"!^", "src/main.go", false, ""},
+		{"!*", "src/main.go dst/main.go", false, ""},
+		{"!:0", "cp", false, ""},
+		{"!2:1", "'a b'", false, ""},
+		{"!2:$", "-l", false, ""},
+		{"!2:1-2", "'a b' c", false, ""},
+		{"!2:-1", "echo 'a b'", false, ""},
+		{"!2:2*", "c | wc -l", false, ""},
+		{"!2:2-", "c | wc", false, ""},
+		{"!2:*", "'a b' c | wc -l", false, ""},
+		{"!3:9", "", false, "ebash: :9: bad word specifier"},
+
+		// modifiers
+		{"!1:$:h", "/usr/local/lib", false, ""},
+		{"!1:$:t", "file.tar.gz", false, ""},
+		{"!1:$:r", "/usr/local/lib/file.tar", false, ""},
+		{"!1:$:e", ".gz", false, ""},
+		{"!1:$:t:r:r", "file", false, ""},
+		{"!!:s/main/test/", "cp src/test.go dst/main.go", false, ""},
+		{"!!:gs/main/test/", "cp src/test.go dst/test.go", false, ""},
+		{"!!:s/main/&_x/", "cp src/main_x.go dst/main.go", false, ""},
+		{"!!:s|src|lib", "cp lib/main.go dst/main.go", false, ""},
+		{"!!:s/main/test/:&", "cp src/test.go dst/test.go", false, ""},
+		{"!2:1:q", `''\''a b'\'''`, false, ""},
+		{"!!:p", "cp src/main.go dst/main.go", true, ""},
+		{"!!:s/nope/x/", "", false, "ebash: :s/nope/x/: substitution failed"},
+		{"!!:x", "", false, "ebash: :x: unrecognized history modifier"},
+		{"!!:gx", "", false, "ebash: :g: unrecognized history modifier"},
+
+		// quick substitution
+		{"^main^test^", "cp src/test.go dst/main.go", false, ""},
+		{"^main^test^ -v", "cp src/test.go dst/main.go -v", false, ""},
+		{"^src/", "cp main.go dst/main.go", false, ""},
+		{"^nope^x", "", false, "ebash: :s^nope^x: substitution failed"},
+
+		// quoting and escaping
+		{"echo '!!'", "echo '!!'", false, ""},
+		{`echo "!!"`, `echo "cp src/main.go dst/main.go"`, false, ""},
+		{`echo "it's !$"`, `echo "it's dst/main.go"`, false, ""},
+		{`echo \!!`, `echo \!!`, false, ""},
+		{"echo ! x", "echo ! x", false, ""},
+		{"echo !", "echo !", false, ""},
+		{"[ a != b ]", "[ a != b ]", false, ""},
+		{"echo !(x)", "echo !(x)", false, ""},
+		{"echo $!", "echo $!", false, ""},
+		{`echo "wow!"`, `echo "wow!"`, false, ""},
+	}
+
+	for _, test := range tests {
+
+		h := New("", 0, Control{})
+		for _, line := range lines {
+			h.Add(line, "")
+		}
+
+		expanded, printOnly, err := h.Expand(test.line)
+		switch {
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("Expand(%q) = %q, %v, want error %q", test.line, expanded, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("Expand(%q) = %v, want %q", test.line, err, test.expanded)
+		case test.err == "" && (expanded != test.expanded || printOnly != test.printOnly):
+			t.Errorf("Expand(%q) = %q, %v, want %q, %v", test.line, expanded, printOnly, test.expanded, test.printOnly)
+		}
+
+	}
+
+}
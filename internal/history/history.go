@@ -0,0 +1,194 @@
+// Package history keeps the command history of an interactive ebash shell
+// and implements csh-style history expansion ("!!", "!$", "^old^new" and so
+// on) on top of it. The history file is shared by every running shell:
+// entries are appended as soon as their line has run, under a file lock, and
+// the entries appended by other shells are merged in as they appear.
+package history
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Entry is a command line of the history together with the circumstances
+// it ran in. Entries read from a plain-text history file only have a Line.
+type Entry struct {
+	Line     string        `json:"line"`               // the command line, after history expansion
+	Time     time.Time     `json:"time"`               // when the line was entered
+	Dir      string        `json:"dir,omitempty"`      // working directory the line was entered in
+	Status   int           `json:"status"`             // exit status of the line
+	Duration time.Duration `json:"duration,omitempty"` // how long the line took to run
+}
+
+// Control selects the lines that are left out of the history, like bash's
+// HISTCONTROL.
+type Control struct {
+	IgnoreSpace bool // do not record lines starting with a blank
+	IgnoreDups  bool // do not record a line equal to the previous entry
+	EraseDups   bool // remove older entries equal to a line when recording it
+}
+
+// History is the list of command lines entered in an interactive shell,
+// oldest first. Entries are numbered from 1, the way "!n" refers to them;
+// entries dropped because of the limit keep their numbers used up. The
+// history file holds one JSON-encoded Entry per line.
+type History struct {
+	entries []*Entry // command lines, oldest first
+	base    int      // number of entries[0]
+	limit   int      // maximum number of entries kept, 0 for no limit
+	control Control  // lines left out of the history
+
+	path    string // history file; "" when the history is not saved
+	unsaved int    // number of entries at the end not yet appended to path
+	offset  int64  // number of bytes of path already merged into entries
+	tail    []byte // bytes of path right before offset, to notice when it gets rewritten
+	stored  int    // number of entries in path up to offset
+	rewrite bool   // path must be rewritten instead of appended to (after erasedups)
+
+	lastOld string // pattern of the last ":s" substitution, reused by ":&"
+	lastNew string // replacement of the last ":s" substitution
+}
+
+// New returns an empty History saved to the file at path (nothing is saved
+// when path is empty), keeping at most limit entries (no limit when limit
+// is zero or negative) and leaving out the lines selected by control.
+func New(path string, limit int, control Control) *History {
+	return &History{base: 1, limit: max(limit, 0), control: control, path: path}
+}
+
+// Path returns the history file, or "" if the history is not saved.
+func (h *History) Path() string {
+	return h.path
+}
+
+// Add appends a command line entered in dir to the history, dropping the
+// oldest entries beyond the limit. Blank lines and the lines excluded by the
+// Control of the history are not recorded; Add reports whether line was.
+// The entry is saved once Finish reports how it ran.
+func (h *History) Add(line, dir string) bool {
+
+	switch {
+	case strings.TrimSpace(line) == "":
+		return false
+	case h.control.IgnoreSpace && (line[0] == ' ' || line[0] == '\t'):
+		return false
+	case h.control.IgnoreDups && len(h.entries) > 0 && h.entries[len(h.entries)-1].Line == line:
+		return false
+	}
+
+	if h.control.EraseDups {
+		h.eraseDups(line)
+	}
+
+	h.entries = append(h.entries, &Entry{Line: line, Time: time.Now(), Dir: dir})
+	h.unsaved++
+	h.trim()
+
+	return true
+
+}
+
+// Finish records the exit status and duration of the last entry and
+// appends the entries not saved yet to the history file.
+func (h *History) Finish(status int, duration time.Duration) error {
+
+	if h.unsaved == 0 {
+		return nil
+	}
+
+	last := h.entries[len(h.entries)-1]
+	last.Status, last.Duration = status, duration
+
+	return h.Append("")
+
+}
+
+// Entries returns the entries of the history with their numbers, oldest
+// first. The entries must not be modified.
+func (h *History) Entries() ([]*Entry, int) {
+	return h.entries, h.base
+}
+
+// Clone returns a copy of h whose entries can be added, deleted and
+// cleared without changing those of h, for a subshell.
+func (h *History) Clone() *History {
+	clone := *h
+	clone.entries = slices.Clone(h.entries)
+	return &clone
+}
+
+// Len returns the number of entries in the history.
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Clear removes every entry; numbering starts over from 1. The history
+// file is left alone.
+func (h *History) Clear() {
+	h.entries, h.base, h.unsaved = nil, 1, 0
+}
+
+// Delete removes the entry numbered n. A negative n counts back from the
+// end of the history, -1 being the last entry. The history file is left
+// alone.
+func (h *History) Delete(n int) error {
+
+	i := n - h.base
+	if n < 0 {
+		i = len(h.entries) + n
+	}
+
+	if i < 0 || i >= len(h.entries) {
+		return fmt.Errorf("%d: history position out of range", n)
+	}
+
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	if i >= len(h.entries)-h.unsaved+1 {
+		h.unsaved--
+	}
+
+	return nil
+
+}
+
+// eraseDups removes the entries equal to line, and makes sure the history
+// file is rewritten without them at the next save.
+func (h *History) eraseDups(line string) {
+
+	var kept []*Entry
+	var unsaved int
+
+	for i, entry := range h.entries {
+		saved := i < len(h.entries)-h.unsaved
+		if entry.Line == line {
+			h.rewrite = h.rewrite || saved
+			continue
+		}
+		kept = append(kept, entry)
+		if !saved {
+			unsaved++
+		}
+	}
+
+	h.entries, h.unsaved = kept, unsaved
+
+}
+
+// insert adds entries merged from the history file before the entries that
+// are not saved yet, which are more recent.
+func (h *History) insert(merged []*Entry) {
+	at := len(h.entries) - h.unsaved
+	h.entries = slices.Insert(h.entries, at, merged...)
+}
+
+// trim drops the oldest entries beyond the limit.
+func (h *History) trim() {
+	if h.limit > 0 && len(h.entries) > h.limit {
+		dropped := len(h.entries) - h.limit
+		h.entries = h.entries[dropped:]
+		h.base += dropped
+		h.unsaved = min(h.unsaved, len(h.entries))
+	}
+}
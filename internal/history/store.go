@@ -0,0 +1,305 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Read appends the entries of the file at path to the history. With an
+// empty path the history file is merged instead (see Merge), and created if
+// needed, the way readline did before. Lines that are not JSON, as written
+// by older versions of ebash, become entries with only a Line. A missing
+// file is not an error.
+func (h *History) Read(path string) error {
+
+	if path == "" || path == h.path {
+		_, err := h.Merge()
+		return err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, _, err := readEntries(file)
+	h.insert(entries)
+	h.trim()
+
+	return err
+
+}
+
+// Merge adds the entries that other shells appended to the history file
+// since it was last read. Entries are inserted before the ones this shell
+// has not saved yet. If the file shrank, because another shell rewrote it,
+// the history is reloaded from it. Reports whether the history changed.
+func (h *History) Merge() (bool, error) {
+
+	if h.path == "" {
+		return false, nil
+	}
+
+	if info, err := os.Stat(h.path); err == nil && h.offset > 0 && info.Size() == h.offset {
+		return false, nil
+	}
+
+	var changed bool
+
+	err := h.locked(syscall.LOCK_SH, func(file *os.File) error {
+		var err error
+		changed, err = h.sync(file)
+		return err
+	})
+
+	return changed, err
+
+}
+
+// Append appends the entries added since the last save to the file at path
+// (the history file when path is empty). The history file is locked while
+// it is written, and the entries other shells appended in the meantime are
+// merged first; it is rewritten as a whole when duplicates were erased from
+// it or when it holds more than twice the history limit.
+func (h *History) Append(path string) error {
+
+	if path != "" && path != h.path {
+		if h.unsaved == 0 {
+			return nil
+		}
+		return writeEntries(path, h.entries[len(h.entries)-h.unsaved:], os.O_APPEND)
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	return h.locked(syscall.LOCK_EX, func(file *os.File) error {
+
+		if _, err := h.sync(file); err != nil {
+			return err
+		}
+
+		if h.rewrite || (h.limit > 0 && h.stored+h.unsaved > 2*h.limit) {
+			return h.store(file, 0, h.entries)
+		}
+
+		if h.unsaved == 0 {
+			return nil
+		}
+
+		return h.store(file, h.offset, h.entries[len(h.entries)-h.unsaved:])
+
+	})
+
+}
+
+// Write replaces the contents of the file at path (the history file when
+// path is empty) with the whole history. The entries other shells appended
+// to the history file since it was last read are merged first.
+func (h *History) Write(path string) error {
+
+	if path != "" && path != h.path {
+		return writeEntries(path, h.entries, os.O_TRUNC)
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	return h.locked(syscall.LOCK_EX, func(file *os.File) error {
+		if _, err := h.sync(file); err != nil {
+			return err
+		}
+		return h.store(file, 0, h.entries)
+	})
+
+}
+
+// locked opens the history file, creating it if needed, and calls fn while
+// holding a lock of the given kind (syscall.LOCK_SH or syscall.LOCK_EX) on
+// it. The lock is released when the file is closed.
+func (h *History) locked(how int, fn func(*os.File) error) error {
+
+	file, err := os.OpenFile(h.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		return err
+	}
+
+	return fn(file)
+
+}
+
+// sync merges the entries found in the locked history file past the offset
+// already read. When the file no longer ends that part with the bytes seen
+// last time, it was rewritten by another shell, and every saved entry is
+// reloaded from it.
+func (h *History) sync(file *os.File) (bool, error) {
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if info.Size() == h.offset {
+		return false, nil
+	}
+
+	if tail, err := fingerprint(file, h.offset); info.Size() < h.offset || err != nil || !bytes.Equal(tail, h.tail) {
+		h.entries = h.entries[len(h.entries)-h.unsaved:]
+		h.base, h.offset, h.stored = 1, 0, 0
+	}
+
+	if _, err := file.Seek(h.offset, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	entries, read, err := readEntries(file)
+	h.offset += read
+	h.stored += len(entries)
+	h.insert(entries)
+	h.trim()
+
+	if err != nil {
+		return true, err
+	}
+
+	h.tail, err = fingerprint(file, h.offset)
+
+	return true, err
+
+}
+
+// store writes entries to the locked history file at offset, truncating the
+// file there, and updates the bookkeeping of what the file holds. With a
+// zero offset the file is rewritten from scratch.
+func (h *History) store(file *os.File, offset int64, entries []*Entry) error {
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(buffer.Bytes(), offset); err != nil {
+		return err
+	}
+
+	if offset == 0 {
+		h.stored, h.rewrite = 0, false
+	}
+
+	h.offset = offset + int64(buffer.Len())
+	h.stored += len(entries)
+	h.unsaved = 0
+
+	var err error
+	h.tail, err = fingerprint(file, h.offset)
+
+	return err
+
+}
+
+// fingerprint returns the bytes of the history file right before offset,
+// which identify the part of the file that was already read or written.
+func fingerprint(file *os.File, offset int64) ([]byte, error) {
+	start := max(offset-64, 0)
+	tail := make([]byte, offset-start)
+	if _, err := file.ReadAt(tail, start); err != nil {
+		return nil, err
+	}
+	return tail, nil
+}
+
+// readEntries decodes the history entries in the rest of file and returns
+// them with the number of bytes read.
+func readEntries(file *os.File) ([]*Entry, int64, error) {
+
+	var entries []*Entry
+	var read int64
+
+	reader := bufio.NewReader(file)
+
+	for {
+		text, err := reader.ReadString('\n')
+		read += int64(len(text))
+		if entry := decode(strings.TrimSuffix(text, "\n")); entry != nil {
+			entries = append(entries, entry)
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, read, nil
+		} else if err != nil {
+			return entries, read, err
+		}
+	}
+
+}
+
+// decode parses a line of a history file. Returns nil for blank lines.
+func decode(text string) *Entry {
+
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(text, "{") {
+		entry := new(Entry)
+		if err := json.Unmarshal([]byte(text), entry); err == nil && entry.Line != "" {
+			return entry
+		}
+	}
+
+	return &Entry{Line: text}
+
+}
+
+// writeEntries writes entries to a file other than the history file, one
+// JSON object per line. flag selects between appending (os.O_APPEND) and
+// truncating (os.O_TRUNC) the file.
+func writeEntries(path string, entries []*Entry, flag int) error {
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
@@ -0,0 +1,143 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// lines returns the command lines of the entries of h, oldest first.
+func lines(h *History) []string {
+	entries, _ := h.Entries()
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, entry.Line)
+	}
+	return lines
+}
+
+// run adds line to h as if it was entered and ran.
+func run(t *testing.T, h *History, line string) {
+	t.Helper()
+	h.Add(line, "/")
+	if err := h.Finish(0, 0); err != nil {
+		t.Fatalf("Finish after %q: %v", line, err)
+	}
+}
+
+// open returns a History on path with the given limit, read from the file.
+func open(t *testing.T, path string, limit int) *History {
+	t.Helper()
+	h := New(path, limit, Control{})
+	if err := h.Read(""); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return h
+}
+
+func TestInterleavedAppends(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "history")
+	first, second := open(t, path, 0), open(t, path, 0)
+
+	run(t, first, "one")
+	run(t, second, "two")
+	run(t, first, "three")
+
+	second.Add("four", "/")
+	if _, err := second.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Finish(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := first.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"one", "two", "three", "four"}
+	if got := lines(first); !slices.Equal(got, want) {
+		t.Errorf("first shell has %q, want %q", got, want)
+	}
+	if got := lines(second); !slices.Equal(got, want) {
+		t.Errorf("second shell has %q, want %q", got, want)
+	}
+	if got := lines(open(t, path, 0)); !slices.Equal(got, want) {
+		t.Errorf("history file has %q, want %q", got, want)
+	}
+
+}
+
+func TestMergeAfterRewrite(t *testing.T) {
+
+	long := "echo " + strings.Repeat("x", 500)
+
+	tests := []struct {
+		name  string
+		after []string // lines the rewriting shell runs after the rewrite
+		want  []string
+	}{
+		{"shrunk", nil, []string{"three"}},
+		{"grown", []string{long}, []string{"three", long}},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(t.TempDir(), "history")
+		writer, reader := open(t, path, 1), open(t, path, 0)
+
+		run(t, writer, "one")
+		run(t, writer, "two")
+		if _, err := reader.Merge(); err != nil {
+			t.Fatal(err)
+		}
+
+		run(t, writer, "three") // more than twice the limit: the file is rewritten
+		for _, line := range test.after {
+			run(t, writer, line)
+		}
+
+		changed, err := reader.Merge()
+		if err != nil || !changed {
+			t.Fatalf("%s: Merge = %v, %v, want true, nil", test.name, changed, err)
+		}
+		if got := lines(reader); !slices.Equal(got, test.want) {
+			t.Errorf("%s: reader has %q, want %q", test.name, got, test.want)
+		}
+		if _, base := reader.Entries(); base != 1 {
+			t.Errorf("%s: reader numbers entries from %d, want 1", test.name, base)
+		}
+
+	}
+
+}
+
+func TestPlainTextHistory(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("ls -l\n\necho {a,b}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := open(t, path, 0)
+	run(t, h, "pwd")
+
+	want := []string{"ls -l", "echo {a,b}", "pwd"}
+	if got := lines(h); !slices.Equal(got, want) {
+		t.Errorf("history has %q, want %q", got, want)
+	}
+
+	reread := open(t, path, 0)
+	if got := lines(reread); !slices.Equal(got, want) {
+		t.Fatalf("history file has %q, want %q", got, want)
+	}
+
+	entries, _ := reread.Entries()
+	if !entries[0].Time.IsZero() || entries[2].Time.IsZero() || entries[2].Dir != "/" {
+		t.Errorf("plain-text entry %+v or JSON entry %+v decoded wrongly", entries[0], entries[2])
+	}
+
+}
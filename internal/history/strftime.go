@@ -0,0 +1,110 @@
+package history
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strftime formats t according to a strftime(3) format, as used by
+// HISTTIMEFORMAT. The common conversions are supported:
+//
+//	%Y %y %C  year, 2-digit year, century     %m %b %B  month, abbreviated, full
+//	%d %e %j  day of month (0- / space-padded), day of year
+//	%a %A %u %w  weekday: abbreviated, full, 1-7 (Monday 1), 0-6 (Sunday 0)
+//	%H %I %M %S %p  hour (24h, 12h), minute, second, AM/PM
+//	%F %T %D %R %c  "%Y-%m-%d", "%H:%M:%S", "%m/%d/%y", "%H:%M", locale-like date
+//	%z %Z %s  zone offset, zone name, seconds since the epoch
+//	%n %t %%  newline, tab, percent sign
+//
+// Unknown conversions are copied unchanged.
+func Strftime(format string, t time.Time) string {
+
+	var builder strings.Builder
+
+	for i := 0; i < len(format); i++ {
+
+		if format[i] != '%' || i+1 == len(format) {
+			builder.WriteByte(format[i])
+			continue
+		}
+
+		i++
+
+		switch format[i] {
+		case 'Y':
+			builder.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			builder.WriteString(t.Format("06"))
+		case 'C':
+			builder.WriteString(pad(t.Year()/100, '0'))
+		case 'm':
+			builder.WriteString(t.Format("01"))
+		case 'b', 'h':
+			builder.WriteString(t.Format("Jan"))
+		case 'B':
+			builder.WriteString(t.Format("January"))
+		case 'd':
+			builder.WriteString(t.Format("02"))
+		case 'e':
+			builder.WriteString(pad(t.Day(), ' '))
+		case 'j':
+			builder.WriteString(t.Format("002"))
+		case 'a':
+			builder.WriteString(t.Format("Mon"))
+		case 'A':
+			builder.WriteString(t.Format("Monday"))
+		case 'u':
+			builder.WriteString(strconv.Itoa((int(t.Weekday())+6)%7 + 1))
+		case 'w':
+			builder.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'H':
+			builder.WriteString(t.Format("15"))
+		case 'I':
+			builder.WriteString(t.Format("03"))
+		case 'M':
+			builder.WriteString(t.Format("04"))
+		case 'S':
+			builder.WriteString(t.Format("05"))
+		case 'p':
+			builder.WriteString(t.Format("PM"))
+		case 'F':
+			builder.WriteString(t.Format("2006-01-02"))
+		case 'T':
+			builder.WriteString(t.Format("15:04:05"))
+		case 'D':
+			builder.WriteString(t.Format("01/02/06"))
+		case 'R':
+			builder.WriteString(t.Format("15:04"))
+		case 'c':
+			builder.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'z':
+			builder.WriteString(t.Format("-0700"))
+		case 'Z':
+			builder.WriteString(t.Format("MST"))
+		case 's':
+			builder.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'n':
+			builder.WriteByte('\n')
+		case 't':
+			builder.WriteByte('\t')
+		case '%':
+			builder.WriteByte('%')
+		default:
+			builder.WriteByte('%')
+			builder.WriteByte(format[i])
+		}
+
+	}
+
+	return builder.String()
+
+}
+
+// pad formats a number below 100 on two characters, padded with fill.
+func pad(n int, fill byte) string {
+	if n < 10 {
+		return string(fill) + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
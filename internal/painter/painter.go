@@ -135,6 +135,12 @@ func resolveColor(colour string) string {
 
 }
 
+// Colour converts a colour name, such as "green" or "bright yellow", into
+// its escape sequence. Escape sequences are returned unchanged.
+func Colour(name string) string {
+	return resolveColor(name)
+}
+
 // Paint applies the provided bold and color settings to the given text
 // and returns the formatted string with ANSI escape sequences.
 func (p Painter) Paint(bold bool, colour string, text string) string {
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"strings"
+)
+
+// expandAliases replaces the first word of every simple command in line
+// with its alias definition. The replacement text is expanded again, so
+// aliases may refer to other aliases, but an alias is never expanded inside
+// its own expansion. If a definition ends with a blank, the word following
+// it is checked for an alias as well. Words containing quotes or
+// backslashes (such as "\ls") are never alias-expanded.
+func expandAliases(line string, aliases map[string]string) string {
+	return expandAliasesIn(line, aliases, map[string]bool{})
+}
+
+// expandAliasesIn performs alias expansion on text, skipping the aliases
+// in expanding, which are being expanded by the callers.
+func expandAliasesIn(text string, aliases map[string]string, expanding map[string]bool) string {
+
+	var builder strings.Builder
+
+	active, _ := activeBytes(text)
+	commandPosition := true
+
+	for i := 0; i < len(text); {
+
+		if active[i] && (text[i] == ' ' || text[i] == '\t') {
+			builder.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		if operator := commandSeparator(text[i:]); active[i] && operator != "" {
+			builder.WriteString(operator)
+			i += len(operator)
+			commandPosition = true
+			continue
+		}
+
+		start := i
+		for i < len(text) && !(active[i] && (strings.IndexByte(" \t|&<>", text[i]) >= 0)) {
+			i++
+		}
+		if i == start {
+			builder.WriteByte(text[i])
+			i++
+			continue
+		}
+		word := text[start:i]
+
+		if !commandPosition {
+			builder.WriteString(word)
+			continue
+		}
+
+		commandPosition = false
+
+		value, ok := aliases[word]
+		if !ok || expanding[word] || strings.ContainsAny(word, `'"\`) {
+			builder.WriteString(word)
+			continue
+		}
+
+		expanding[word] = true
+		builder.WriteString(expandAliasesIn(value, aliases, expanding))
+		delete(expanding, word)
+
+		if strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t") {
+			commandPosition = true
+		}
+
+	}
+
+	return builder.String()
+
+}
+
+// commandSeparator returns the operator at the start of s after which a
+// new simple command begins ("&&", "||" or "|"), or "" if there is none.
+func commandSeparator(s string) string {
+	for _, operator := range []string{"&&", "||", "|"} {
+		if strings.HasPrefix(s, operator) {
+			return operator
+		}
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+package parser
+
+import "strings"
+
+// Kind classifies a part of a command line, as reported by Lex.
+type Kind int
+
+const (
+	Command  Kind = iota // first word of a simple command
+	Argument             // any other word
+	Operator             // "&&", "||", "|", "<", ">", ">>" or ">|"
+	String               // quoted text, quotes included
+	Variable             // variable reference, such as "$HOME" or "${1}"
+	Comment              // unquoted "#" starting a word, up to the end of the line
+)
+
+// Span is a part of a command line: the bytes line[Start:End] are of the
+// given Kind. For words (Command and Argument spans) Text holds the word
+// with its quotes removed, or "" when the word refers to a variable and its
+// value is only known once it is expanded.
+type Span struct {
+	Kind  Kind
+	Start int
+	End   int
+	Text  string
+}
+
+// Lex splits line into spans for syntax highlighting, without expanding
+// anything and without failing: an unterminated quote runs to the end of the
+// line. Every word is reported as a Command or Argument span, followed by
+// the String and Variable spans found inside it, so that painting the spans
+// in order colours the parts of a word over the word itself. The word after
+// a redirection operator is an Argument, and the word after "&&", "||" or
+// "|" is a Command again.
+func Lex(line string) []Span {
+
+	var spans []Span
+
+	command := true
+	redirected := false
+
+	for i := 0; i < len(line); {
+
+		char := line[i]
+		operator := operatorAt(line[i:])
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			i++
+		case char == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			spans = append(spans, Span{Kind: Comment, Start: i, End: len(line)})
+			i = len(line)
+		case operator != "":
+			spans = append(spans, Span{Kind: Operator, Start: i, End: i + len(operator)})
+			if commandSeparator(operator) != "" {
+				command, redirected = true, false
+			} else {
+				redirected = true
+			}
+			i += len(operator)
+		default:
+			kind := Argument
+			if command && !redirected {
+				kind, command = Command, false
+			}
+			redirected = false
+			spans, i = lexWord(line, i, kind, spans)
+		}
+
+	}
+
+	return spans
+
+}
+
+// lexWord appends the span of the word starting at line[start] to spans,
+// followed by the spans of its quoted parts and variable references, and
+// returns the spans with the index of the byte following the word.
+func lexWord(line string, start int, kind Kind, spans []Span) ([]Span, int) {
+
+	spans = append(spans, Span{Kind: kind, Start: start})
+	word := len(spans) - 1
+
+	var text strings.Builder
+	expanded := false
+
+	i := start
+
+	for i < len(line) {
+
+		char := line[i]
+
+		if char == ' ' || char == '\t' || char == '\n' || operatorAt(line[i:]) != "" {
+			break
+		}
+
+		switch char {
+		case '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				end = len(line)
+			} else {
+				end += i + 2
+			}
+			text.WriteString(strings.Trim(line[i:end], "'"))
+			spans = append(spans, Span{Kind: String, Start: i, End: end})
+			i = end
+		case '"':
+			quote := len(spans)
+			spans = append(spans, Span{Kind: String, Start: i})
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$\"\\`", line[i+1]) >= 0:
+					i++
+					text.WriteByte(line[i])
+				case line[i] == '$':
+					_, length, ok := variableReference(line[i:])
+					if ok {
+						spans = append(spans, Span{Kind: Variable, Start: i, End: i + length})
+						expanded = true
+					}
+					text.WriteString(line[i : i+length])
+					i += length - 1
+				default:
+					text.WriteByte(line[i])
+				}
+			}
+			i = min(i+1, len(line))
+			spans[quote].End = i
+		case '\\':
+			if i+1 < len(line) {
+				text.WriteByte(line[i+1])
+			}
+			i = min(i+2, len(line))
+		case '$':
+			_, length, ok := variableReference(line[i:])
+			if ok {
+				spans = append(spans, Span{Kind: Variable, Start: i, End: i + length})
+				expanded = true
+			}
+			text.WriteString(line[i : i+length])
+			i += length
+		default:
+			text.WriteByte(char)
+			i++
+		}
+
+	}
+
+	spans[word].End = i
+	if !expanded {
+		spans[word].Text = text.String()
+	}
+
+	return spans, i
+
+}
+
+// operatorAt returns the operator at the start of s, or "" if there is
+// none. A single "&" is not an operator.
+func operatorAt(s string) string {
+	if separator := commandSeparator(s); separator != "" {
+		return separator
+	}
+	for _, operator := range operators {
+		if strings.HasPrefix(s, operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+// LastWord returns the span of the word at the end of line, the word a
+// completion applies to. When line ends with a blank or an operator, the
+// span is empty, at the end of line, and has the Kind the next word would
+// have. Returns false when the end of line is inside a comment.
+func LastWord(line string) (Span, bool) {
+
+	command, redirected := true, false
+
+	for _, span := range Lex(line) {
+		switch span.Kind {
+		case Command, Argument:
+			if span.End == len(line) {
+				return span, true
+			}
+			command = command && span.Kind != Command
+			redirected = false
+		case Operator:
+			separator := commandSeparator(line[span.Start:span.End]) != ""
+			command = command || separator
+			redirected = !separator
+		case Comment:
+			return Span{}, false
+		}
+	}
+
+	kind := Argument
+	if command && !redirected {
+		kind = Command
+	}
+
+	return Span{Kind: kind, Start: len(line), End: len(line)}, true
+
+}
+
+// OpenQuote returns the quote character left open at the end of line, or 0
+// if every quote is closed.
+func OpenQuote(line string) byte {
+	_, quote := activeBytes(line)
+	return quote
+}
@@ -1,19 +1,28 @@
 // Package parser parses a command line into a pipeline of Pipe structures.
-// It handles conditional operators (&&, ||), pipes (|), and simple
-// redirections (<, >). The parser produces a slice of Pipe values that the
-// shell executor can run sequentially.
+// It handles conditional operators (&&, ||), pipes (|), simple
+// redirections (<, >, >>, >|), quoting and pathname expansion. The parser
+// produces a slice of Pipe values that the shell executor builds and runs
+// sequentially.
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"unicode"
 )
 
 // Pipe represents a single conditional block of commands within a shell pipeline.
-// Section holds the commands with their arguments, Input and Output handle optional redirections,
-// and NextAnd / NextOr indicate conditional execution of the following pipe.
+// Raw keeps the unexpanded text of the block; Section holds the commands with their
+// arguments and Input and Output handle optional redirections once the pipe is built.
+// NextAnd / NextOr indicate conditional execution of the following pipe.
 type Pipe struct {
+	Raw     string     // Unexpanded text of this conditional block
 	Section [][]string // Commands (with arguments) forming this conditional pipe section
 	Input   *os.File   // Optional input redirection file
 	Output  *os.File   // Optional output redirection file
@@ -21,27 +30,74 @@ type Pipe struct {
 	NextOr  bool       // True if the next pipe runs only if this one fails
 }
 
-// Parse takes a raw command-line string and converts it into a slice of Pipe
-// structures. It expands environment variables, normalizes spacing around
-// operators, splits the input by conditional operators (&& and ||), and then
-// builds each pipe section (handling pipes and redirections). Returns an
-// error when building a section or opening redirection files fails.
-func Parse(line string) ([]Pipe, error) {
+// SimpleCommand is a command of a pipe section as Build sees it before opening
+// any redirection file or expanding any pattern.
+type SimpleCommand struct {
+	Words        []string      // The command and its arguments
+	Redirections []Redirection // Redirections of the command, in order
+}
+
+// Redirection is a redirection operator ("<", ">", ">>" or ">|") with the
+// word naming its file, which is empty when the operator has none.
+type Redirection struct {
+	Operator string
+	Target   string
+}
+
+// Env holds the shell state consulted while expanding a pipe.
+type Env struct {
+	Status     int      // Exit status of the most recently executed pipe, expanded by "$?"
+	Args       []string // Positional parameters; Args[0] is "$0", Args[1] is "$1" and so on
+	NoUnset    bool     // Treat the expansion of unset variables as an error (set -u)
+	NoClobber  bool     // Refuse to overwrite existing files with ">" (set -C)
+	NoGlob     bool     // Disable pathname expansion (set -f)
+	NullGlob   bool     // Patterns matching no files expand to nothing (shopt nullglob)
+	FailGlob   bool     // Patterns matching no files are an error (shopt failglob)
+	DotGlob    bool     // Patterns match file names starting with "." (shopt dotglob)
+	NoCaseGlob bool     // Patterns match file names case-insensitively (shopt nocaseglob)
+
+	Aliases       map[string]string // Alias definitions, by name
+	ExpandAliases bool              // Replace the first word of simple commands by its alias (shopt expand_aliases)
+}
+
+// ErrUnbound is wrapped by the error Build returns when an unset variable
+// is expanded while Env.NoUnset is set.
+var ErrUnbound = errors.New("unbound variable")
 
-	line = expandEnv(line)
-	line = strings.NewReplacer("&&", " && ", "||", " || ", ">>", " >> ", ">", " > ", "<", " < ").Replace(line)
+// Parse takes a raw command-line string and converts it into a slice of Pipe
+// structures by splitting it on the conditional operators (&& and ||).
+// Operators and comments inside quotes are taken literally; an unquoted word
+// starting with "#" begins a comment that runs to the end of the line.
+// Expansion and redirections are deferred to Build, so every pipe observes
+// the state left behind by the pipes executed before it. Aliases, however,
+// are expanded right away when env.ExpandAliases is set. Returns an error
+// when a quote is left open or an operator, a pipe included, is missing one
+// of its operands.
+func Parse(line string, env *Env) ([]Pipe, error) {
 
 	var pipeline []Pipe
 	var nextAnd, nextOr bool
 
-	conditionals := splitByConditionals(line)
+	if env.ExpandAliases && len(env.Aliases) > 0 {
+		line = expandAliases(line, env.Aliases)
+	}
+
+	if _, quote := activeBytes(line); quote != 0 {
+		return nil, fmt.Errorf("ebash: unexpected EOF while looking for matching `%c'", quote)
+	}
+
+	conditionals := splitByConditionals(stripComment(line))
 
 	for i := 0; i < len(conditionals); i++ {
 
 		conditional := conditionals[i]
 
-		if conditional == "" || conditional == "&&" || conditional == "||" {
+		if conditional == "&&" || conditional == "||" {
+			return nil, fmt.Errorf("ebash: syntax error near unexpected token `%s'", conditional)
+		} else if conditional == "" {
 			continue
+		} else if err := checkPipes(conditional); err != nil {
+			return nil, err
 		}
 
 		if i+1 < len(conditionals) {
@@ -53,15 +109,8 @@ func Parse(line string) ([]Pipe, error) {
 			}
 		}
 
-		section, input, output, err := buildSection(conditional)
-		if err != nil {
-			return nil, err
-		}
-
 		pipeline = append(pipeline, Pipe{
-			Section: section,
-			Input:   input,
-			Output:  output,
+			Raw:     conditional,
 			NextAnd: nextAnd,
 			NextOr:  nextOr,
 		})
@@ -76,17 +125,96 @@ func Parse(line string) ([]Pipe, error) {
 	return pipeline, nil
 }
 
+// Build tokenizes the raw text of the pipe (removing quotes and expanding
+// variables) and builds its section (handling pipes, redirections and
+// pathname expansion). It is called right before the pipe runs. Returns an
+// error when an unset variable is expanded under set -u, when a pattern
+// matches nothing under failglob, or when opening redirection files fails.
+func (pipe *Pipe) Build(env *Env) error {
+
+	tokens, err := tokenize(pipe.Raw, env)
+	if err != nil {
+		return err
+	}
+
+	section, input, output, err := buildSection(tokens, env)
+	if err != nil {
+		return err
+	}
+
+	pipe.Section, pipe.Input, pipe.Output = section, input, output
+
+	return nil
+
+}
+
+// Commands tokenizes the raw text of the pipe like Build does and returns
+// the commands of its section with their redirections, without opening any
+// file or expanding any pattern. Returns an error when an unset variable is
+// expanded under set -u.
+func (pipe Pipe) Commands(env *Env) ([]SimpleCommand, error) {
+
+	tokens, err := tokenize(pipe.Raw, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []SimpleCommand
+
+	for _, tokens := range splitByPipes(tokens) {
+
+		var command SimpleCommand
+
+		for i := 0; i < len(tokens); i++ {
+			switch {
+			case !tokens[i].operator:
+				command.Words = append(command.Words, tokens[i].text)
+			case i+1 < len(tokens) && !tokens[i+1].operator:
+				command.Redirections = append(command.Redirections, Redirection{tokens[i].text, tokens[i+1].text})
+				i++
+			default:
+				command.Redirections = append(command.Redirections, Redirection{Operator: tokens[i].text})
+			}
+		}
+
+		commands = append(commands, command)
+
+	}
+
+	return commands, nil
+
+}
+
+// stripComment cuts the line at the first unquoted "#" that starts a word,
+// i.e. one at the beginning of the line or preceded by whitespace.
+func stripComment(line string) string {
+	active, _ := activeBytes(line)
+	for i := 0; i < len(line); i++ {
+		if active[i] && line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
 // splitByConditionals scans the line and splits it into a slice where each
 // element is either a conditional operator ("&&" or "||") or the text
-// between operators. It preserves ordering and trims whitespace only when
-// producing the final slice element.
+// between operators. Operators inside quotes are not recognized. It preserves
+// ordering and trims whitespace only when producing the final slice element.
 func splitByConditionals(line string) []string {
 
 	var conditionals []string
 	var builder strings.Builder
 
+	active, _ := activeBytes(line)
+
 	for currByte := 0; currByte < len(line); currByte++ {
 
+		if !active[currByte] {
+			builder.WriteByte(line[currByte])
+			continue
+		}
+
 		if currByte < len(line)-1 && line[currByte] == '&' && line[currByte+1] == '&' {
 			saveWithOperator(&builder, "&&", &conditionals, &currByte)
 			continue
@@ -105,6 +233,36 @@ func splitByConditionals(line string) []string {
 
 }
 
+// checkPipes reports the syntax error bash reports when a pipe of the
+// conditional block has no command on one of its sides. The "|" of ">|"
+// does not separate commands.
+func checkPipes(conditional string) error {
+
+	active, _ := activeBytes(conditional)
+
+	start := 0
+
+	for i := 0; i <= len(conditional); i++ {
+
+		if i < len(conditional) && (!active[i] || conditional[i] != '|' || (i > 0 && conditional[i-1] == '>')) {
+			continue
+		}
+
+		if strings.TrimSpace(conditional[start:i]) == "" {
+			if i == len(conditional) {
+				return fmt.Errorf("ebash: syntax error: unexpected end of file")
+			}
+			return fmt.Errorf("ebash: syntax error near unexpected token `|'")
+		}
+
+		start = i + 1
+
+	}
+
+	return nil
+
+}
+
 // saveWithOperator flushes the current builder contents into the
 // conditionals slice (if non-empty), appends the operator token, and advances
 // the cursor (currByte) to account for the two-character operator.
@@ -117,46 +275,58 @@ func saveWithOperator(builder *strings.Builder, operator string, conditionals *[
 	(*currByte)++
 }
 
-// buildSection takes a conditional string (a part of the input without &&/||)
-// and splits it by pipe symbols to produce a section (list of commands).
-// It recognizes input redirection (<) for the first command and output
-// redirection (>, >>) for the last command, opens the corresponding files,
-// and returns them alongside the parsed command arguments for each command
-// in the section.
-func buildSection(conditional string) ([][]string, *os.File, *os.File, error) {
+// buildSection takes the tokens of a conditional block (a part of the input
+// without &&/||) and splits them by pipe operators to produce a section
+// (list of commands). It recognizes input redirection (<) for the first
+// command and output redirection (>, >>, >|) for the last command, opens
+// the corresponding files, performs pathname expansion on the remaining
+// words, and returns the files alongside the command arguments for each
+// command in the section.
+func buildSection(tokens []token, env *Env) ([][]string, *os.File, *os.File, error) {
 
 	var err error
 	var section [][]string
 	var input, output *os.File
 
-	commands := strings.Split(conditional, "|")
+	commands := splitByPipes(tokens)
 
 	for i, command := range commands {
 
-		cmdWithArgs := strings.Fields(strings.TrimSpace(command))
-		if len(cmdWithArgs) == 0 {
+		if len(command) == 0 {
 			continue
 		}
 
-		if i == 0 && strings.Contains(command, "<") {
-			input, cmdWithArgs, err = redirect(cmdWithArgs, "<")
+		if i == 0 && hasOperator(command, "<") {
+			input, command, err = redirect(command, "<", env)
 			if err != nil {
 				return nil, nil, nil, err
 			}
 		}
 
-		if i == len(commands)-1 && strings.Contains(command, ">") {
-			if strings.Contains(command, ">>") {
-				output, cmdWithArgs, err = redirect(cmdWithArgs, ">>")
-			} else {
-				output, cmdWithArgs, err = redirect(cmdWithArgs, ">")
+		if i == len(commands)-1 {
+			switch {
+			case hasOperator(command, ">>"):
+				output, command, err = redirect(command, ">>", env)
+			case hasOperator(command, ">|"):
+				output, command, err = redirect(command, ">|", env)
+			case hasOperator(command, ">"):
+				output, command, err = redirect(command, ">", env)
 			}
 		}
 		if err != nil {
+			closeFiles(input)
 			return nil, nil, nil, err
 		}
 
-		section = append(section, cmdWithArgs)
+		cmdWithArgs, err := expandGlobs(command, env)
+		if err != nil {
+			closeFiles(input, output)
+			return nil, nil, nil, err
+		}
+
+		if len(cmdWithArgs) > 0 {
+			section = append(section, cmdWithArgs)
+		}
 
 	}
 
@@ -164,65 +334,225 @@ func buildSection(conditional string) ([][]string, *os.File, *os.File, error) {
 
 }
 
-// redirect searches cmdWithArgs for a redirection operator ("<", ">" or ">>"),
-// opens the referenced file accordingly (read for "<", create/truncate for ">",
-// append for ">>"), removes the redirection tokens from the argument slice,
-// and returns the opened file along with the cleaned arguments. If no redirection
-// operator is found, it returns the original arguments and a nil file.
-func redirect(cmdWithArgs []string, direction string) (*os.File, []string, error) {
+// splitByPipes splits the tokens of a conditional block into the commands
+// of its pipe section.
+func splitByPipes(tokens []token) [][]token {
 
-	for i := range cmdWithArgs {
+	var commands [][]token
 
-		if cmdWithArgs[i] == direction && i+1 < len(cmdWithArgs) {
+	start := 0
+	for i, token := range tokens {
+		if token.operator && token.text == "|" {
+			commands = append(commands, tokens[start:i])
+			start = i + 1
+		}
+	}
 
-			var err error
-			var file *os.File
+	return append(commands, tokens[start:])
 
-			switch direction {
-			case ">":
-				file, err = os.Create(cmdWithArgs[i+1])
-			case ">>":
-				file, err = os.OpenFile(cmdWithArgs[i+1], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
-			case "<":
-				file, err = os.Open(cmdWithArgs[i+1])
+}
+
+// hasOperator reports whether command contains the given operator token.
+func hasOperator(command []token, operator string) bool {
+	return slices.ContainsFunc(command, func(token token) bool {
+		return token.operator && token.text == operator
+	})
+}
+
+// redirect searches command for a redirection operator ("<", ">", ">|" or ">>"),
+// opens the referenced file accordingly (read for "<", create/truncate for ">"
+// and ">|", append for ">>"), removes the redirection tokens from the command,
+// and returns the opened file along with the remaining tokens. Under set -C,
+// ">" refuses to truncate an existing regular file while ">|" always does.
+// An operator without a file name is a syntax error. If no redirection
+// operator is found, it returns the original tokens and a nil file.
+func redirect(command []token, direction string, env *Env) (*os.File, []token, error) {
+
+	for i := range command {
+
+		if !command[i].operator || command[i].text != direction {
+			continue
+		}
+
+		if i+1 >= len(command) {
+			return nil, nil, fmt.Errorf("ebash: syntax error near unexpected token `newline'")
+		} else if command[i+1].operator {
+			return nil, nil, fmt.Errorf("ebash: syntax error near unexpected token `%s'", command[i+1].text)
+		}
+
+		var err error
+		var file *os.File
+
+		name := command[i+1].text
+
+		switch direction {
+		case ">":
+			if !env.NoClobber {
+				file, err = os.Create(name)
+				break
 			}
-			if err != nil {
-				return nil, nil, err
+			file, err = createNoClobber(name)
+			if errors.Is(err, fs.ErrExist) {
+				return nil, nil, fmt.Errorf("ebash: %s: cannot overwrite existing file", name)
 			}
+		case ">|":
+			file, err = os.Create(name)
+		case ">>":
+			file, err = os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
+		case "<":
+			file, err = os.Open(name)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("ebash: %s: %s", name, describe(err))
+		}
+
+		withoutRedirect := append([]token{}, command[:i]...)
+		withoutRedirect = append(withoutRedirect, command[i+2:]...)
+
+		return file, withoutRedirect, nil
+
+	}
+
+	return nil, command, nil
+
+}
+
+// createNoClobber opens name for ">" under set -C. A file that does not
+// exist is created exclusively, so that a file another process creates in
+// the meantime is not truncated. An existing file that is not a regular file,
+// such as /dev/null, is opened without being truncated; an existing regular
+// file is refused with an error wrapping fs.ErrExist.
+func createNoClobber(name string) (*os.File, error) {
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if !errors.Is(err, fs.ErrExist) {
+		return file, err
+	}
+
+	if info, statErr := os.Stat(name); statErr == nil && !info.Mode().IsRegular() {
+		return os.OpenFile(name, os.O_WRONLY, 0)
+	}
+
+	return nil, err
+
+}
+
+// describe returns the description of the system error behind err the way
+// bash prints it, capitalized like strerror(3) capitalizes it, or the error
+// itself if there is no such error.
+func describe(err error) string {
+
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err.Error()
+	}
+
+	message := errno.Error()
 
-			argsWithoutRedirect := append([]string{}, cmdWithArgs[:i]...)
-			argsWithoutRedirect = append(argsWithoutRedirect, cmdWithArgs[i+2:]...)
+	return strings.ToUpper(message[:1]) + message[1:]
 
-			return file, argsWithoutRedirect, nil
+}
+
+// closeFiles closes every non-nil file; used to release redirection files
+// when building a section fails halfway.
+func closeFiles(files ...*os.File) {
+	for _, file := range files {
+		if file != nil {
+			_ = file.Close()
+		}
+	}
+}
+
+// expandGlobs turns the tokens of a command into its arguments, performing
+// pathname expansion on every unquoted word containing one of the pattern
+// characters "*", "?" or "[". Matches are sorted and, unless
+// Env.DotGlob is set, exclude names starting with "." that the pattern does
+// not spell out explicitly. A pattern matching nothing is kept as it is,
+// removed under nullglob, or reported as an error under failglob. Nothing
+// is expanded under set -f.
+func expandGlobs(command []token, env *Env) ([]string, error) {
+
+	var expanded []string
+
+	for _, token := range command {
+
+		word := token.text
+
+		if env.NoGlob || token.quoted || token.operator || !strings.ContainsAny(word, "*?[") {
+			expanded = append(expanded, word)
+			continue
+		}
+
+		pattern := word
+		if env.NoCaseGlob {
+			pattern = foldPattern(word)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			expanded = append(expanded, word)
+			continue
+		}
 
+		if !env.DotGlob {
+			matches = slices.DeleteFunc(matches, func(match string) bool {
+				return hiddenMatch(word, match)
+			})
+		}
+
+		switch {
+		case len(matches) > 0:
+			expanded = append(expanded, matches...)
+		case env.FailGlob:
+			return nil, fmt.Errorf("ebash: no match: %s", word)
+		case !env.NullGlob:
+			expanded = append(expanded, word)
 		}
 
 	}
 
-	return nil, cmdWithArgs, nil
+	return expanded, nil
 
 }
 
-// expandEnv replaces environment variable references in the given string
-// using the same rules as os.Expand, with additional support for:
-//
-//   - "$$": expands to the current process ID (os.Getpid())
-//   - "$PPID": expands to the parent process ID (os.Getppid())
-//
-// All other variables are expanded from the current environment using
-// os.LookupEnv. Unrecognized variables are replaced with an empty string.
-func expandEnv(line string) string {
-	return os.Expand(line, func(key string) string {
-		switch key {
-		case "$":
-			return strconv.Itoa(os.Getpid())
-		case "PPID":
-			return strconv.Itoa(os.Getppid())
-		default:
-			if val, ok := os.LookupEnv(key); ok {
-				return val
-			}
-			return ""
+// hiddenMatch reports whether match contains a path component starting
+// with "." whose pattern component does not start with "." itself.
+func hiddenMatch(pattern, match string) bool {
+
+	patternParts := strings.Split(pattern, "/")
+	matchParts := strings.Split(match, "/")
+
+	for i, part := range matchParts {
+		if i < len(patternParts) && strings.HasPrefix(part, ".") && !strings.HasPrefix(patternParts[i], ".") {
+			return true
 		}
-	})
+	}
+
+	return false
+
+}
+
+// foldPattern makes a pattern case-insensitive by replacing every letter
+// outside of a bracket expression with a bracket expression matching both
+// of its cases.
+func foldPattern(pattern string) string {
+
+	var builder strings.Builder
+	var inBrackets bool
+
+	for _, char := range pattern {
+		switch {
+		case char == '[':
+			inBrackets = true
+		case char == ']':
+			inBrackets = false
+		case !inBrackets && unicode.IsLetter(char) && unicode.ToLower(char) != unicode.ToUpper(char):
+			builder.WriteString("[" + string(unicode.ToLower(char)) + string(unicode.ToUpper(char)) + "]")
+			continue
+		}
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+
 }
@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseSyntaxErrors(t *testing.T) {
+
+	tests := []struct {
+		line string
+		err  string // expected error; "" when the line is valid
+	}{
+		{"echo a | cat", ""},
+		{"echo a >| out | cat", ""},
+		{"echo 'a|' | cat", ""},
+		{"echo a\\| | cat", ""},
+		{"< in | cat", ""},
+		{"| cat", "ebash: syntax error near unexpected token `|'"},
+		{"echo a | | cat", "ebash: syntax error near unexpected token `|'"},
+		{"echo a | cat && | cat", "ebash: syntax error near unexpected token `|'"},
+		{"echo a |", "ebash: syntax error: unexpected end of file"},
+		{"&& echo a", "ebash: syntax error near unexpected token `&&'"},
+		{"echo 'a", "ebash: unexpected EOF while looking for matching `''"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.line, &Env{})
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("Parse(%q) = %v, want no error", test.line, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("Parse(%q) = %v, want %q", test.line, err, test.err)
+		}
+	}
+
+}
+
+func TestBuild(t *testing.T) {
+
+	tests := []struct {
+		line    string
+		status  int
+		args    []string
+		section [][]string
+	}{
+		{"echo $?", 127, nil, [][]string{{"echo", "127"}}},
+		{"echo \"$?\" '$?'", 2, nil, [][]string{{"echo", "2", "$?"}}},
+		{"echo $0 $1 $#", 0, []string{"name", "one", "two"}, [][]string{{"echo", "name", "one", "2"}}},
+		{"echo \"$1\" $2 | cat", 0, []string{"name", "a b", "c d"}, [][]string{{"echo", "a b", "c", "d"}, {"cat"}}},
+	}
+
+	for _, test := range tests {
+
+		pipeline, err := Parse(test.line, &Env{})
+		if err != nil || len(pipeline) != 1 {
+			t.Fatalf("Parse(%q) = %v, %v", test.line, pipeline, err)
+		}
+
+		if err := pipeline[0].Build(&Env{Status: test.status, Args: test.args}); err != nil {
+			t.Errorf("Build(%q) = %v", test.line, err)
+		} else if !slices.EqualFunc(pipeline[0].Section, test.section, slices.Equal) {
+			t.Errorf("Build(%q) = %q, want %q", test.line, pipeline[0].Section, test.section)
+		}
+
+	}
+
+}
+
+func TestBuildRedirectErrors(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"cat < " + filepath.Join(dir, "missing"), "ebash: " + filepath.Join(dir, "missing") + ": No such file or directory"},
+		{"echo a > " + filepath.Join(dir, "missing", "file"), "ebash: " + filepath.Join(dir, "missing", "file") + ": No such file or directory"},
+		{"echo a > " + dir, "ebash: " + dir + ": Is a directory"},
+		{"echo a >", "ebash: syntax error near unexpected token `newline'"},
+	}
+
+	for _, test := range tests {
+
+		pipeline, err := Parse(test.line, &Env{})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.line, err)
+		}
+
+		err = pipeline[0].Build(&Env{})
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Build(%q) = %v, want %q", test.line, err, test.err)
+		}
+		closeFiles(pipeline[0].Input, pipeline[0].Output)
+
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("failed redirections created %d files", len(entries))
+	}
+
+}
+
+func TestExpandGlobs(t *testing.T) {
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", ".hidden.txt", "Upper.TXT", "sub/c.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		line string
+		env  Env
+		args []string // arguments of echo; nil when Build fails
+	}{
+		{"echo *.txt", Env{}, []string{"a.txt", "b.txt"}},
+		{"echo [ab].txt ?.txt", Env{}, []string{"a.txt", "b.txt", "a.txt", "b.txt"}},
+		{"echo sub/*", Env{}, []string{"sub/c.txt"}},
+		{"echo .*.txt", Env{}, []string{".hidden.txt"}},
+		{"echo '*.txt' \"*\" \\*", Env{}, []string{"*.txt", "*", "*"}},
+		{"echo *.txt", Env{DotGlob: true}, []string{".hidden.txt", "a.txt", "b.txt"}},
+		{"echo *.txt", Env{NoCaseGlob: true}, []string{"Upper.TXT", "a.txt", "b.txt"}},
+		{"echo *.txt", Env{NoGlob: true}, []string{"*.txt"}},
+		{"echo *.none", Env{}, []string{"*.none"}},
+		{"echo *.none", Env{NullGlob: true}, []string{}},
+		{"echo *.none", Env{FailGlob: true}, nil},
+	}
+
+	for _, test := range tests {
+
+		pipeline, err := Parse(test.line, &Env{})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.line, err)
+		}
+
+		err = pipeline[0].Build(&test.env)
+		switch {
+		case test.args == nil && err == nil:
+			t.Errorf("Build(%q) with %+v = %q, want an error", test.line, test.env, pipeline[0].Section)
+		case test.args != nil && err != nil:
+			t.Errorf("Build(%q) with %+v = %v", test.line, test.env, err)
+		case test.args != nil && !slices.Equal(pipeline[0].Section[0][1:], test.args):
+			t.Errorf("Build(%q) with %+v = %q, want %q", test.line, test.env, pipeline[0].Section[0][1:], test.args)
+		}
+
+	}
+
+}
+
+func TestNoClobber(t *testing.T) {
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, []byte("kept\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line      string
+		noClobber bool
+		err       string // expected error; "" when the redirection succeeds
+	}{
+		{"echo > " + existing, true, "ebash: " + existing + ": cannot overwrite existing file"},
+		{"echo > " + filepath.Join(dir, "new"), true, ""},
+		{"echo > /dev/null", true, ""},
+		{"echo >> " + existing, true, ""},
+		{"echo >| " + existing, true, ""},
+		{"echo > " + existing, false, ""},
+	}
+
+	for _, test := range tests {
+
+		pipeline, err := Parse(test.line, &Env{})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.line, err)
+		}
+
+		err = pipeline[0].Build(&Env{NoClobber: test.noClobber})
+		closeFiles(pipeline[0].Input, pipeline[0].Output)
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("Build(%q) with noclobber %v = %v", test.line, test.noClobber, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("Build(%q) with noclobber %v = %v, want %q", test.line, test.noClobber, err, test.err)
+		}
+
+		if test.err != "" {
+			if data, _ := os.ReadFile(existing); string(data) != "kept\n" {
+				t.Errorf("Build(%q) with noclobber truncated the file", test.line)
+			}
+		}
+
+	}
+
+}
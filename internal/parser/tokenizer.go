@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// token is a word or an operator of a conditional block, as produced by
+// tokenize. Words have their quotes removed and their variables expanded.
+type token struct {
+	text     string // the word or the operator itself
+	operator bool   // true for "|", "<", ">", ">>" and ">|"
+	quoted   bool   // true if any part of the word was quoted or escaped
+}
+
+// operators lists the operators recognized inside a conditional block,
+// longest first so that ">>" and ">|" win over ">".
+var operators = []string{">>", ">|", ">", "<", "|"}
+
+// activeBytes reports, for every byte of line, whether it is outside of
+// quotes and not escaped by a backslash, i.e. whether it can start an
+// operator or a comment. It also returns the quote character that is still
+// open at the end of the line, or 0 if every quote is closed.
+func activeBytes(line string) ([]bool, byte) {
+
+	var quote byte
+	active := make([]bool, len(line))
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quote == '\'':
+			if line[i] == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				quote = 0
+			}
+		case line[i] == '\\':
+			i++
+		case line[i] == '\'' || line[i] == '"':
+			quote = line[i]
+		default:
+			active[i] = true
+		}
+	}
+
+	return active, quote
+
+}
+
+// tokenize splits the raw text of a conditional block into words and
+// operators the way a POSIX shell does:
+//
+//   - text in single quotes is taken literally
+//   - text in double quotes is taken literally except for variable
+//     references and the escapes \$, \", \\ and \`
+//   - outside of quotes a backslash escapes the next character, unquoted
+//     whitespace separates words and "|", "<", ">", ">>", ">|" are operators
+//   - variables expanded outside of quotes are split into words on
+//     whitespace, variables expanded inside double quotes are not
+//
+// Returns an error wrapping ErrUnbound when an unset variable is expanded
+// while Env.NoUnset is set.
+func tokenize(raw string, env *Env) ([]token, error) {
+
+	var tokens []token
+	var word strings.Builder
+	var inWord, quoted, single, double bool
+	var unbound string
+
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, token{text: word.String(), quoted: quoted})
+			word.Reset()
+			inWord, quoted = false, false
+		}
+	}
+
+	for i := 0; i < len(raw); i++ {
+
+		char := raw[i]
+
+		switch {
+		case single:
+			if char == '\'' {
+				single = false
+			} else {
+				word.WriteByte(char)
+			}
+		case double:
+			switch {
+			case char == '"':
+				double = false
+			case char == '\\' && i+1 < len(raw) && strings.IndexByte("$\"\\`", raw[i+1]) >= 0:
+				i++
+				word.WriteByte(raw[i])
+			case char == '$':
+				value, length := expandVariable(raw[i:], env, &unbound)
+				word.WriteString(value)
+				i += length - 1
+			default:
+				word.WriteByte(char)
+			}
+		case char == '\'':
+			single, inWord, quoted = true, true, true
+		case char == '"':
+			double, inWord, quoted = true, true, true
+		case char == '\\' && i+1 < len(raw):
+			i++
+			word.WriteByte(raw[i])
+			inWord, quoted = true, true
+		case char == ' ' || char == '\t' || char == '\n':
+			flush()
+		case char == '|' || char == '<' || char == '>':
+			flush()
+			for _, operator := range operators {
+				if strings.HasPrefix(raw[i:], operator) {
+					tokens = append(tokens, token{text: operator, operator: true})
+					i += len(operator) - 1
+					break
+				}
+			}
+		case char == '$':
+			value, length := expandVariable(raw[i:], env, &unbound)
+			i += length - 1
+			if value == "" {
+				break
+			}
+			if strings.ContainsRune(" \t\n", rune(value[0])) {
+				flush()
+			}
+			fields := strings.Fields(value)
+			for j, field := range fields {
+				if j > 0 {
+					flush()
+				}
+				word.WriteString(field)
+				inWord = true
+			}
+			if strings.ContainsRune(" \t\n", rune(value[len(value)-1])) {
+				flush()
+			}
+		default:
+			word.WriteByte(char)
+			inWord = true
+		}
+
+	}
+
+	flush()
+
+	if env.NoUnset && unbound != "" {
+		return nil, fmt.Errorf("ebash: %s: %w", unbound, ErrUnbound)
+	}
+
+	return tokens, nil
+
+}
+
+// expandVariable expands the variable reference at the start of s, which
+// begins with "$", and returns the value together with the number of bytes
+// of s that the reference occupies. A "$" that does not start a reference is
+// returned literally. The name of the first unset variable is recorded in
+// unbound.
+func expandVariable(s string, env *Env, unbound *string) (string, int) {
+
+	name, length, ok := variableReference(s)
+	if !ok {
+		return s[:length], length
+	}
+
+	value, set := lookupVariable(name, env)
+	if !set && *unbound == "" {
+		*unbound = name
+	}
+
+	return value, length
+
+}
+
+// variableReference parses the variable reference at the start of s, which
+// begins with "$". It supports "${name}", "$name" and the single-character
+// special parameters, and returns the name of the variable with the number
+// of bytes of s that the reference occupies. ok is false when the "$" does
+// not start a reference (length is then 1) or starts a "${" that is never
+// closed (length then covers the rest of s).
+func variableReference(s string) (name string, length int, ok bool) {
+
+	switch {
+	case len(s) < 2:
+		return "", 1, false
+	case s[1] == '{':
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "", len(s), false
+		}
+		return s[2:end], end + 1, true
+	case strings.IndexByte("*#$@!?-0123456789", s[1]) >= 0:
+		return s[1:2], 2, true
+	case isNameStart(s[1]):
+		length = 2
+		for length < len(s) && (isNameStart(s[length]) || (s[length] >= '0' && s[length] <= '9')) {
+			length++
+		}
+		return s[1:length], length, true
+	default:
+		return "", 1, false
+	}
+
+}
+
+// isNameStart reports whether c can start a variable name.
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// lookupVariable returns the value of a variable and whether it is set,
+// with support for the special parameters:
+//
+//   - "$$": expands to the current process ID (os.Getpid())
+//   - "$PPID": expands to the parent process ID (os.Getppid())
+//   - "$?": expands to the exit status of the last executed pipe
+//   - "$0".."$9" and "${10}"...: expand to the positional parameters
+//   - "$#": expands to the number of positional parameters
+//   - "$@" and "$*": expand to all positional parameters joined by spaces
+//
+// All other variables are looked up in the current environment using
+// os.LookupEnv.
+func lookupVariable(name string, env *Env) (string, bool) {
+
+	switch name {
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "?":
+		return strconv.Itoa(env.Status), true
+	case "#":
+		return strconv.Itoa(max(len(env.Args)-1, 0)), true
+	case "@", "*":
+		if len(env.Args) < 2 {
+			return "", true
+		}
+		return strings.Join(env.Args[1:], " "), true
+	case "PPID":
+		return strconv.Itoa(os.Getppid()), true
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		if n >= 0 && n < len(env.Args) {
+			return env.Args[n], true
+		}
+		return "", false
+	}
+
+	return os.LookupEnv(name)
+
+}